@@ -7,6 +7,7 @@ import (
 
 	"github.com/chewxy/lingo/corpus"
 	"github.com/go-nlp/tfidf"
+	"github.com/pkg/errors"
 )
 
 const tiny = 0.0000001
@@ -40,35 +41,150 @@ type doc []int
 
 func (d doc) IDs() []int { return []int(d) }
 
+// Config holds the settings of a Classifier that are saved alongside its statistics.
+type Config struct {
+	// Tiny is the probability assigned to a word that has never been seen in a class.
+	Tiny float64
+
+	// Model is the name of the event model used for scoring. See Models.
+	Model string
+
+	// Smoothing is the additive smoothing parameter α of the multinomial, Bernoulli and
+	// complement models. 1 is Laplace smoothing.
+	Smoothing float64
+
+	// Tokenizer is how raw text is turned into words.
+	Tokenizer TokenizerConfig
+
+	// Buckets is the number of buckets words are hashed into. 0 means words are kept in a
+	// vocabulary instead. See WithHashing.
+	Buckets int
+
+	// Signed is whether hashed words are also given a sign. It is always false, as signed
+	// hashing is meaningless for word counts; see WithHashing.
+	Signed bool
+
+	// Calibration turns the score margin of Spam over Ham into the probability of Spam.
+	Calibration Calibration
+
+	// Threshold is the probability of Spam above which a document is classified as Spam.
+	// It is chosen by Tune.
+	Threshold float64
+
+	// Seed is the seed of the split of the examples into those the classifier was trained on
+	// and those held out from it. See holdOut.
+	Seed int64
+}
+
 type Classifier struct {
+	Config
 	corpus *corpus.Corpus
+	model  Model
 
-	tfidfs [MAXCLASS]*tfidf.TFIDF
-	totals [MAXCLASS]float64
+	tfidfs [MAXCLASS]*tfidf.TFIDF    // TF holds the number of documents of a class a word appears in
+	counts [MAXCLASS]map[int]float64 // number of times a word appears in a class
+	tokens [MAXCLASS]float64         // number of words in a class
+	totals [MAXCLASS]float64         // number of documents in a class
 
-	ready bool
-	sync.Mutex
+	pruned map[int]struct{} // buckets of a hashed classifier removed by pruning or feature selection
+	fixed  bool             // whether pruning has fixed the vocabulary, so that new words are ignored
+
+	ready bool // whether the IDFs reflect every trained document
+	sync.RWMutex
 }
 
+// ConsOpt is a construction option for a Classifier.
+type ConsOpt func(c *Classifier) error
+
+// WithModel sets the event model of the classifier by name.
+func WithModel(name string) ConsOpt {
+	return func(c *Classifier) (err error) {
+		c.model, err = modelByName(name)
+		c.Model = name
+		return
+	}
+}
+
+// WithSmoothing sets the additive smoothing parameter.
+func WithSmoothing(alpha float64) ConsOpt {
+	return func(c *Classifier) error {
+		if alpha <= 0 {
+			return errors.Errorf("Smoothing has to be positive. Got %v", alpha)
+		}
+		c.Smoothing = alpha
+		return nil
+	}
+}
+
+// WithTokenizer sets how the classifier tokenizes raw text.
+func WithTokenizer(conf TokenizerConfig) ConsOpt {
+	return func(c *Classifier) error {
+		if conf.NGrams < 0 {
+			return errors.Errorf("NGrams cannot be negative. Got %d", conf.NGrams)
+		}
+		if conf.CharNGrams < 0 {
+			return errors.Errorf("CharNGrams cannot be negative. Got %d", conf.CharNGrams)
+		}
+		c.Tokenizer = conf
+		return nil
+	}
+}
+
+// New creates a classifier using the original TF-IDF weighted scoring.
 func New() *Classifier {
-	var tfidfs [MAXCLASS]*tfidf.TFIDF
-	for i := Ham; i < MAXCLASS; i++ {
-		tfidfs[i] = tfidf.New()
+	c, _ := Construct()
+	return c
+}
+
+// Construct creates a classifier with the given options.
+func Construct(opts ...ConsOpt) (*Classifier, error) {
+	c := newClassifier(Config{
+		Tiny:        tiny,
+		Model:       "tfidf",
+		Smoothing:   1,
+		Tokenizer:   DefaultTokenizerConfig(),
+		Calibration: Calibration{A: -1},
+		Threshold:   0.5,
+	})
+	c.model = tfidfModel{}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
 	}
-	return &Classifier{
+	return c, nil
+}
+
+func newClassifier(conf Config) *Classifier {
+	c := &Classifier{
+		Config: conf,
 		corpus: corpus.New(),
-		tfidfs: tfidfs,
+		pruned: make(map[int]struct{}),
+	}
+	for i := Ham; i < MAXCLASS; i++ {
+		c.tfidfs[i] = tfidf.New()
+		c.counts[i] = make(map[int]float64)
 	}
+	return c
 }
 
+// Train adds the examples to the classifier's statistics. It may be called at any time,
+// including after the classifier has been used for prediction: the IDFs are then recalculated
+// before the next prediction.
 func (c *Classifier) Train(examples []Example) {
+	c.Lock()
 	for _, ex := range examples {
 		c.trainOne(ex)
 	}
+	c.ready = false
+	c.Unlock()
 }
 
+// Postprocess calculates the IDFs from the documents seen so far, and prepares the model.
+// It is safe to call Postprocess more than once.
 func (c *Classifier) Postprocess() {
 	c.Lock()
+	defer c.Unlock()
 	if c.ready {
 		return
 	}
@@ -78,51 +194,127 @@ func (c *Classifier) Postprocess() {
 		docs += t.Docs
 	}
 	for _, t := range c.tfidfs {
-		t.Docs = docs
 		// t.CalculateIDF()
 		for k, v := range t.TF {
-			t.IDF[k] = math.Log1p(float64(t.Docs) / v)
+			t.IDF[k] = math.Log1p(float64(docs) / v)
 		}
 	}
+	c.model.prepare(c)
 	c.ready = true
-	c.Unlock()
 }
 
-func (c *Classifier) Score(sentence []string) (scores [MAXCLASS]float64) {
-	if !c.ready {
-		c.Postprocess()
-	}
-
-	d := make(doc, len(sentence))
-	for i, word := range sentence {
-		id := c.corpus.Add(word)
-		d[i] = id
-	}
+// Score returns the log probability of each class given the sentence. Score does not modify
+// the classifier, and is safe to call concurrently with other calls to Score, Predict and Train.
+func (c *Classifier) Score(sentence []string) [MAXCLASS]float64 {
+	c.rlockReady()
+	defer c.RUnlock()
+	return c.score(sentence)
+}
 
+// score scores the sentence with the classifier read-locked.
+func (c *Classifier) score(sentence []string) (scores [MAXCLASS]float64) {
+	d := c.lookup(sentence)
 	priors := c.priors()
 
 	// score per class
 	for i := range c.tfidfs {
 		score := math.Log(priors[i])
 		// likelihood
-		for _, word := range sentence {
-			prob := c.prob(word, Class(i))
-			score += math.Log(prob)
-		}
+		score += c.model.logLikelihood(c, d, Class(i))
 
 		scores[i] = score
 	}
 	return
 }
 
+// Predict classifies the sentence as Spam when its probability of Spam is above the threshold.
 func (c *Classifier) Predict(sentence []string) Class {
-	scores := c.Score(sentence)
-	return argmax(scores)
+	c.rlockReady()
+	defer c.RUnlock()
+	return c.decide(c.score(sentence))
+}
+
+// Tokenize splits raw text into words the way the classifier was configured to.
+func (c *Classifier) Tokenize(text string) []string {
+	return NewTokenizer(c.Tokenizer).Tokenize(text)
+}
+
+// PredictText tokenizes raw text and predicts its class.
+func (c *Classifier) PredictText(text string) Class {
+	return c.Predict(c.Tokenize(text))
+}
+
+// rlockReady read-locks the classifier, postprocessing it first if it has been trained since
+// the IDFs were last calculated.
+func (c *Classifier) rlockReady() {
+	c.RLock()
+	for !c.ready {
+		c.RUnlock()
+		c.Postprocess()
+		c.RLock()
+	}
+}
+
+// lookup returns the IDs of the words of the sentence, without adding new words to the corpus.
+// Words that have never been seen or have been pruned are -1. A hashed classifier returns the
+// hashed document instead.
+func (c *Classifier) lookup(sentence []string) doc {
+	if c.hashed() {
+		d := c.hashDoc(sentence)
+		for i, id := range d {
+			if _, ok := c.pruned[id]; ok {
+				d[i] = -1
+			}
+		}
+		return d
+	}
+	d := make(doc, len(sentence))
+	for i, word := range sentence {
+		d[i] = c.wordID(word)
+	}
+	return d
+}
+
+// wordID is the ID of a word, -1 if it has never been seen or has been pruned. For a hashed
+// classifier it is the bucket of the word.
+func (c *Classifier) wordID(word string) int {
+	var id int
+	if c.hashed() {
+		id = c.bucket(word)
+	} else {
+		var ok bool
+		if id, ok = c.corpus.Id(word); !ok {
+			return -1
+		}
+	}
+	if _, ok := c.pruned[id]; ok {
+		return -1
+	}
+	return id
 }
 
+// vocabSize is the number of distinct words the classifier knows of, or the number of buckets,
+// less the pruned ones.
+func (c *Classifier) vocabSize() int {
+	if c.hashed() {
+		return c.Buckets - len(c.pruned)
+	}
+	return c.corpus.Size() - len(c.pruned)
+}
+
+// unseens counts the words of the sentence that have never been seen in training. For a hashed
+// classifier, these are the words hashed into buckets no trained word has been hashed into.
 func (c *Classifier) unseens(sentence []string) (retVal int) {
+	c.RLock()
+	defer c.RUnlock()
 	for _, word := range sentence {
-		if _, ok := c.corpus.Id(word); !ok {
+		id := c.wordID(word)
+		var seen bool
+		for i := range c.counts {
+			_, ok := c.counts[i][id]
+			seen = seen || ok
+		}
+		if !seen {
 			retVal++
 		}
 	}
@@ -130,12 +322,34 @@ func (c *Classifier) unseens(sentence []string) (retVal int) {
 }
 
 func (c *Classifier) trainOne(example Example) {
-	d := make(doc, len(example.Document))
-	for i, word := range example.Document {
-		id := c.corpus.Add(word)
-		d[i] = id
+	var d doc
+	if c.hashed() {
+		d = c.hashDoc(example.Document)
+	} else {
+		d = make(doc, 0, len(example.Document))
+		for _, word := range example.Document {
+			if !c.fixed {
+				d = append(d, c.corpus.Add(word))
+			} else if id, ok := c.corpus.Id(word); ok {
+				d = append(d, id)
+			}
+		}
+	}
+	if len(c.pruned) > 0 {
+		// pruned words stay pruned.
+		kept := d[:0]
+		for _, id := range d {
+			if _, ok := c.pruned[id]; !ok {
+				kept = append(kept, id)
+			}
+		}
+		d = kept
 	}
 	c.tfidfs[example.Class].Add(d)
+	for _, id := range d {
+		c.counts[example.Class][id]++
+	}
+	c.tokens[example.Class] += float64(len(d))
 	c.totals[example.Class]++
 }
 
@@ -152,10 +366,9 @@ func (c *Classifier) priors() (priors []float64) {
 	return
 }
 
-func (c *Classifier) prob(word string, class Class) float64 {
-	id, ok := c.corpus.Id(word)
-	if !ok {
-		return tiny
+func (c *Classifier) prob(id int, class Class) float64 {
+	if id < 0 {
+		return c.Tiny
 	}
 
 	freq := c.tfidfs[class].TF[id]
@@ -164,7 +377,7 @@ func (c *Classifier) prob(word string, class Class) float64 {
 
 	// a word may not appear at all in a class.
 	if freq == 0 {
-		return tiny
+		return c.Tiny
 	}
 
 	return freq * idf / c.totals[class]
@@ -183,11 +396,10 @@ func argmax(a [MAXCLASS]float64) Class {
 	return maxClass
 }
 
-func shuffle(a []Example) {
-	// r := rand.New(rand.NewSource(time.Now().Unix()))
-
+// shuffle shuffles the examples with r, so that the same seed gives the same order.
+func shuffle(a []Example, r *rand.Rand) {
 	for i := len(a) - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
+		j := r.Intn(i + 1)
 		a[i], a[j] = a[j], a[i]
 		// b[i], b[j] = b[j], b[i]
 	}
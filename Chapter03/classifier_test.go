@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var toyExamples = []Example{
+	{strings.Fields("cheap viagra buy now"), Spam},
+	{strings.Fields("buy cheap watches now"), Spam},
+	{strings.Fields("win money now click here"), Spam},
+	{strings.Fields("meeting notes for the linguistics seminar"), Ham},
+	{strings.Fields("the seminar on syntax is moved to friday"), Ham},
+	{strings.Fields("call for papers on linguistics and syntax"), Ham},
+}
+
+func TestSaveLoad(t *testing.T) {
+	for _, name := range Models {
+		c, err := Construct(WithModel(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Train(toyExamples)
+
+		var buf bytes.Buffer
+		if err := c.Save(&buf); err != nil {
+			t.Fatal(err)
+		}
+		c2, err := Load(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, doc := range [][]string{
+			strings.Fields("buy cheap money now"),
+			strings.Fields("syntax seminar papers"),
+			strings.Fields("never seen before"),
+		} {
+			if s1, s2 := c.Score(doc), c2.Score(doc); !closeScores(s1, s2) {
+				t.Errorf("%v: Score(%v): expected %v. Got %v", name, doc, s1, s2)
+			}
+		}
+	}
+}
+
+func TestModels(t *testing.T) {
+	for _, name := range Models {
+		c, err := Construct(WithModel(name), WithSmoothing(0.5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Train(toyExamples)
+		if class := c.Predict(strings.Fields("cheap money now")); class != Spam {
+			t.Errorf("%v: Expected Spam. Got %v", name, class)
+		}
+		if class := c.Predict(strings.Fields("syntax seminar on friday")); class != Ham {
+			t.Errorf("%v: Expected Ham. Got %v", name, class)
+		}
+	}
+
+	// the multinomial likelihoods of a class sum to one over the vocabulary
+	c, _ := Construct(WithModel("multinomial"))
+	c.Train(toyExamples)
+	c.Postprocess()
+	for class := Ham; class < MAXCLASS; class++ {
+		var sum float64
+		for id := 0; id < c.vocabSize(); id++ {
+			sum += math.Exp(c.model.logProb(c, id, class))
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("Expected the likelihoods of %v to sum to 1. Got %v", class, sum)
+		}
+	}
+
+	if _, err := Construct(WithModel("perceptron")); err == nil {
+		t.Errorf("Expected an error for an unknown model")
+	}
+}
+
+func closeScores(a, b [MAXCLASS]float64) bool {
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLoadVersionMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(modelHeader{Magic: modelMagic, Version: modelVersion + 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(&buf); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("Expected a version error. Got %v", err)
+	}
+}
+
+func TestPostprocessTwice(t *testing.T) {
+	c := New()
+	c.Train(toyExamples)
+	c.Postprocess()
+	c.Postprocess() // used to deadlock
+}
+
+func TestScoreIsReadOnly(t *testing.T) {
+	c := New()
+	c.Train(toyExamples)
+	size := c.corpus.Size()
+	c.Score(strings.Fields("completely novel words"))
+	if c.corpus.Size() != size {
+		t.Errorf("Score grew the vocabulary from %d to %d", size, c.corpus.Size())
+	}
+}
+
+func TestTrainAfterPredict(t *testing.T) {
+	c := New()
+	c.Train(toyExamples)
+	doc := strings.Fields("free lottery prize")
+	before := c.Score(doc)
+
+	c.Train([]Example{
+		{strings.Fields("free lottery prize inside"), Spam},
+		{strings.Fields("claim your free prize"), Spam},
+	})
+	after := c.Score(doc)
+	if after[Spam]-after[Ham] <= before[Spam]-before[Ham] {
+		t.Errorf("Expected online training to move %v towards Spam. Before %v, after %v", doc, before, after)
+	}
+	if class := c.Predict(doc); class != Spam {
+		t.Errorf("Expected %v to be Spam after training. Got %v", doc, class)
+	}
+}
+
+func TestConcurrentScoreAndTrain(t *testing.T) {
+	c := New()
+	c.Train(toyExamples)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if i%2 == 0 {
+					c.Train(toyExamples[j%len(toyExamples) : j%len(toyExamples)+1])
+					continue
+				}
+				c.Predict(strings.Fields("buy cheap syntax papers"))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestExplain(t *testing.T) {
+	doc := strings.Fields("buy cheap viagra for the seminar unheardof")
+	for _, name := range Models {
+		c, err := Construct(WithModel(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Train(toyExamples)
+
+		e := c.Explain(doc, 3)
+		if e.Scores != c.Score(doc) {
+			t.Errorf("%v: Explained scores %v differ from Score %v", name, e.Scores, c.Score(doc))
+		}
+		// only the Bernoulli model scores anything besides the tokens of the document
+		if _, ok := c.model.(presenceModel); !ok {
+			for i, base := range e.Base {
+				if math.Abs(base) > 1e-9 {
+					t.Errorf("%v: Expected no base score for %v. Got %v", name, Class(i), base)
+				}
+			}
+		}
+		if len(e.Top[Spam]) == 0 || len(e.Top[Spam]) > 3 || len(e.Top[Ham]) == 0 {
+			t.Fatalf("%v: Expected tokens pushing towards each class. Got %+v", name, e.Top)
+		}
+		for _, tc := range e.Top[Spam] {
+			if tc.Token == "seminar" {
+				t.Errorf("%v: %q listed as pushing towards spam", name, tc.Token)
+			}
+		}
+		if tok := e.Top[Ham][0].Token; tok != "seminar" && tok != "the" && tok != "for" {
+			t.Errorf("%v: Expected a ham word to push most towards ham. Got %q", name, tok)
+		}
+
+		annotated := e.Annotate("Buy VIAGRA at the seminar", NewTokenizer(c.Tokenizer))
+		if !strings.Contains(annotated, "{+VIAGRA+}") {
+			t.Errorf("%v: Expected VIAGRA to be marked as spam in %q", name, annotated)
+		}
+	}
+}
+
+func TestShuffleSeeded(t *testing.T) {
+	shuffled := func(seed int64) []Example {
+		a := append([]Example(nil), toyExamples...)
+		shuffle(a, rand.New(rand.NewSource(seed)))
+		return a
+	}
+	if !reflect.DeepEqual(shuffled(1), shuffled(1)) {
+		t.Errorf("Expected the same seed to shuffle the examples the same way")
+	}
+}
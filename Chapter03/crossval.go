@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/pkg/errors"
+)
+
+// trainer is a classifier that can be trained and then evaluated.
+type trainer interface {
+	scorer
+	Train(examples []Example)
+}
+
+// lingspamVariants are the four preprocessed versions of the lingspam corpus.
+var lingspamVariants = []string{"bare", "lemm", "lemm_stop", "stop"}
+
+// ingestFolds reads the lingspam corpus with each partN directory as a fold.
+func ingestFolds(typ string, tok *Tokenizer) (folds [][]Example, err error) {
+	var errs errList
+	for i := 0; i < 11; i++ {
+		exs, err := ingestParts(typ, tok, i, i+1)
+		if el, ok := err.(errList); ok {
+			errs = append(errs, el...)
+		} else if err != nil {
+			return nil, err
+		}
+		if len(exs) > 0 {
+			folds = append(folds, exs)
+		}
+	}
+	if errs != nil {
+		err = errs
+	}
+	return
+}
+
+// stratifiedFolds randomly splits the examples into k folds, keeping the proportion of each
+// class about the same in every fold.
+func stratifiedFolds(examples []Example, k int, r *rand.Rand) ([][]Example, error) {
+	if k < 2 {
+		return nil, errors.Errorf("Cross validation needs at least 2 folds. Got %d", k)
+	}
+
+	var byClass [MAXCLASS][]Example
+	for _, ex := range examples {
+		byClass[ex.Class] = append(byClass[ex.Class], ex)
+	}
+
+	folds := make([][]Example, k)
+	var next int
+	for _, exs := range byClass {
+		r.Shuffle(len(exs), func(i, j int) { exs[i], exs[j] = exs[j], exs[i] })
+		for _, ex := range exs {
+			folds[next] = append(folds[next], ex)
+			next = (next + 1) % k
+		}
+	}
+	return folds, nil
+}
+
+// crossValidate evaluates a fresh classifier on each fold, after training it on all the other folds.
+func crossValidate(name string, folds [][]Example, fresh func() trainer) ([]Report, error) {
+	if len(folds) < 2 {
+		return nil, errors.Errorf("Cross validation needs at least 2 folds. Got %d", len(folds))
+	}
+
+	reports := make([]Report, len(folds))
+	for i, test := range folds {
+		var train []Example
+		for j, fold := range folds {
+			if j != i {
+				train = append(train, fold...)
+			}
+		}
+		c := fresh()
+		c.Train(train)
+		reports[i] = evaluate(fmt.Sprintf("%s fold %d", name, i+1), c, test)
+	}
+	return reports, nil
+}
+
+// averageReports averages the metrics of the reports of the folds. The confusion matrices are
+// summed. The curves are not averaged, and are left empty.
+func averageReports(name string, reports []Report) Report {
+	avg := Report{Name: name}
+	if len(reports) == 0 {
+		return avg
+	}
+	avg.Classes = make([]ClassMetrics, MAXCLASS)
+	n := float64(len(reports))
+	for _, r := range reports {
+		avg.Examples += r.Examples
+		for i := range r.Confusion {
+			for j := range r.Confusion[i] {
+				avg.Confusion[i][j] += r.Confusion[i][j]
+			}
+		}
+		for i, m := range r.Classes {
+			avg.Classes[i].Class = m.Class
+			avg.Classes[i].Precision += m.Precision / n
+			avg.Classes[i].Recall += m.Recall / n
+			avg.Classes[i].F1 += m.F1 / n
+			avg.Classes[i].Support += m.Support
+		}
+		avg.Accuracy += r.Accuracy / n
+		avg.FalsePositiveRate += r.FalsePositiveRate / n
+		avg.ROCAUC += r.ROCAUC / n
+		avg.PRAUC += r.PRAUC / n
+		if r.Time.After(avg.Time) {
+			avg.Time = r.Time
+		}
+	}
+	return avg
+}
+
+// summary is a one line summary of the report.
+func (r Report) summary() string {
+	var spamF1 float64
+	if len(r.Classes) > int(Spam) {
+		spamF1 = r.Classes[Spam].F1
+	}
+	return fmt.Sprintf("%-30s\tAccuracy %.4f\tFPR %.4f\tSpam F1 %.4f\tROC AUC %.4f\tPR AUC %.4f", r.Name, r.Accuracy, r.FalsePositiveRate, spamF1, r.ROCAUC, r.PRAUC)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Dataset is a corpus of labelled messages on disk.
+type Dataset interface {
+	// Load reads every message of the dataset. Messages that cannot be read are reported in an
+	// errList, and the examples that could be read are still returned.
+	Load(tok *Tokenizer) ([]Example, error)
+}
+
+// Datasets lists the kinds of datasets openDataset knows of.
+var Datasets = []string{"lingspam", "spamassassin", "enron", "csv"}
+
+// openDataset returns the dataset of the given kind at path. variant is the lingspam variant.
+func openDataset(kind, path, variant string) (Dataset, error) {
+	switch kind {
+	case "lingspam", "":
+		if path == "" {
+			path = lingspamDir
+		}
+		return Lingspam{Dir: path, Variant: variant, Start: 0, End: 11}, nil
+	case "spamassassin":
+		return SpamAssassin{Dir: path}, nil
+	case "enron":
+		return Enron{Dir: path}, nil
+	case "csv":
+		return CSV{Path: path}, nil
+	}
+	return nil, errors.Errorf("Unknown dataset %q. Expected one of %v", kind, Datasets)
+}
+
+// source is a file of a dataset that holds one message, and how to read it.
+type source struct {
+	path  string
+	class Class
+	read  func(path string, class Class, tok *Tokenizer) (Example, error)
+}
+
+// fileDataset is a dataset with one message per file.
+type fileDataset interface {
+	Dataset
+	sources() ([]source, error)
+}
+
+// loadSources reads the sources one after the other.
+func loadSources(srcs []source, tok *Tokenizer) (examples []Example, err error) {
+	var errs errList
+	for _, src := range srcs {
+		ex, err := src.read(src.path, src.class, tok)
+		if err != nil {
+			errs = append(errs, errors.WithMessage(err, src.path))
+			continue
+		}
+		examples = append(examples, ex)
+	}
+	if errs != nil {
+		err = errs
+	}
+	return
+}
+
+// readText reads a file of plain text.
+func readText(path string, class Class, tok *Tokenizer) (Example, error) {
+	str, err := ingestOneFile(path, tok)
+	return Example{str, class}, err
+}
+
+const lingspamDir = "data/lingspam_public"
+
+// Lingspam is the Ling-Spam corpus: Dir/variant/partN/*.txt, where spam is named spmsg*.txt.
+// The parts numbered from Start up to, but not including, End are loaded.
+type Lingspam struct {
+	Dir, Variant string
+	Start, End   int
+}
+
+func (ds Lingspam) Load(tok *Tokenizer) ([]Example, error) {
+	srcs, err := ds.sources()
+	if err != nil {
+		return nil, err
+	}
+	return loadSources(srcs, tok)
+}
+
+func (ds Lingspam) sources() (srcs []source, err error) {
+	switch ds.Variant {
+	case "bare", "lemm", "lemm_stop", "stop":
+	default:
+		return nil, errors.Errorf("Expected only \"bare\", \"lemm\", \"lemm_stop\" or \"stop\"")
+	}
+
+	for i := ds.Start; i < ds.End; i++ {
+		matches, err := filepath.Glob(filepath.Join(ds.Dir, ds.Variant, fmt.Sprintf("part%d", i), "*.txt"))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			class := Ham
+			if strings.Contains(match, "spmsg") {
+				class = Spam
+			}
+			srcs = append(srcs, source{match, class, readText})
+		}
+	}
+	return
+}
+
+// SpamAssassin is the SpamAssassin public corpus, with its archives extracted into Dir:
+// Dir/easy_ham, Dir/easy_ham_2, Dir/hard_ham, Dir/spam and Dir/spam_2. Each file is a raw
+// email, except for the cmds file of each directory.
+type SpamAssassin struct {
+	Dir string
+}
+
+func (ds SpamAssassin) Load(tok *Tokenizer) ([]Example, error) {
+	srcs, err := ds.sources()
+	if err != nil {
+		return nil, err
+	}
+	return loadSources(srcs, tok)
+}
+
+func (ds SpamAssassin) sources() (srcs []source, err error) {
+	dirs, err := ioutil.ReadDir(ds.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		var class Class
+		switch name := dir.Name(); {
+		case !dir.IsDir():
+			continue
+		case strings.Contains(name, "spam"):
+			class = Spam
+		case strings.Contains(name, "ham"):
+			class = Ham
+		default:
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(ds.Dir, dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() || file.Name() == "cmds" || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			srcs = append(srcs, source{filepath.Join(ds.Dir, dir.Name(), file.Name()), class, loadSpamAssassinMessage})
+		}
+	}
+	return
+}
+
+// loadSpamAssassinMessage reads a message of the SpamAssassin corpus. The messages start with
+// the "From " line of the mbox they were taken from, which is not a header.
+func loadSpamAssassinMessage(path string, class Class, tok *Tokenizer) (Example, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Example{}, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if peek, _ := r.Peek(5); string(peek) == "From " {
+		if _, err := r.ReadString('\n'); err != nil {
+			return Example{}, err
+		}
+	}
+	return readEML(r, class, tok)
+}
+
+// Enron is the Enron-Spam corpus: Dir/enronN/ham/*.txt and Dir/enronN/spam/*.txt. Dir may also
+// be a single enronN directory.
+type Enron struct {
+	Dir string
+}
+
+func (ds Enron) Load(tok *Tokenizer) ([]Example, error) {
+	srcs, err := ds.sources()
+	if err != nil {
+		return nil, err
+	}
+	return loadSources(srcs, tok)
+}
+
+func (ds Enron) sources() (srcs []source, err error) {
+	for _, sub := range []struct {
+		dir   string
+		class Class
+	}{{"ham", Ham}, {"spam", Spam}} {
+		for _, pattern := range []string{
+			filepath.Join(ds.Dir, sub.dir, "*.txt"),
+			filepath.Join(ds.Dir, "*", sub.dir, "*.txt"),
+		} {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, match := range matches {
+				srcs = append(srcs, source{match, sub.class, readText})
+			}
+		}
+	}
+	if len(srcs) == 0 {
+		return nil, errors.Errorf("No ham or spam directories found in %v", ds.Dir)
+	}
+	return
+}
+
+// CSV is a CSV file of label,text records. The label is "spam" or "ham" (or "1" or "0").
+// A first record whose label is neither is taken to be a header. Any fields after the
+// second are taken to be part of the text.
+type CSV struct {
+	Path string
+}
+
+func (ds CSV) Load(tok *Tokenizer) ([]Example, error) {
+	f, err := os.Open(ds.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readCSV(f, ds.Path, tok)
+}
+
+func readCSV(r io.Reader, path string, tok *Tokenizer) (examples []Example, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	var errs errList
+	for record := 1; ; record++ {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				errs = append(errs, errors.WithMessage(err, path))
+				continue
+			}
+			return examples, err
+		}
+		if len(fields) < 2 {
+			errs = append(errs, errors.Errorf("%v: record %d: expected label,text. Got %d fields", path, record, len(fields)))
+			continue
+		}
+
+		class, ok := parseLabel(fields[0])
+		if !ok {
+			if record == 1 {
+				continue
+			}
+			errs = append(errs, errors.Errorf("%v: record %d: unknown label %q", path, record, fields[0]))
+			continue
+		}
+		text := strings.Join(fields[1:], ",")
+		examples = append(examples, Example{tok.Tokenize(text), class})
+	}
+	if errs != nil {
+		err = errs
+	}
+	return
+}
+
+func parseLabel(label string) (Class, bool) {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "spam", "1":
+		return Spam, true
+	case "ham", "0":
+		return Ham, true
+	}
+	return Ham, false
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func countClasses(exs []Example) (counts [MAXCLASS]int) {
+	for _, ex := range exs {
+		counts[ex.Class]++
+	}
+	return
+}
+
+func TestDatasets(t *testing.T) {
+	dir := t.TempDir()
+	tok := NewTokenizer(DefaultTokenizerConfig())
+	msg := "From a@example.com  Mon Jul 29 11:28:02 2002\nFrom: a@example.com\nSubject: hello\n\nbody\n"
+	writeFiles(t, dir, map[string]string{
+		"sa/easy_ham/00001.7c53336b37003a9286aba55d2945844c": msg,
+		"sa/easy_ham/cmds":    "mv 00001 00001.7c53336b37003a9286aba55d2945844c\n",
+		"sa/hard_ham/00002.a": msg,
+		"sa/spam_2/00003.b":   msg,
+		"sa/README":           "not a message",
+
+		"enron/enron1/ham/0001.txt":  "Subject: meeting\nsee you at noon\n",
+		"enron/enron1/spam/0002.txt": "Subject: offer\ncheap pills\n",
+		"enron/enron2/spam/0003.txt": "Subject: offer\ncheap watches\n",
+
+		"spam.csv": "v1,v2\nham,\"Are we meeting, then?\"\nspam,WIN a prize,,\nmaybe,unlabelled\n1,Free entry\n",
+	})
+
+	exs, err := SpamAssassin{Dir: filepath.Join(dir, "sa")}.Load(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts := countClasses(exs); counts != [MAXCLASS]int{2, 1} {
+		t.Errorf("Expected 2 ham and 1 spam from SpamAssassin. Got %v", counts)
+	}
+	if doc := strings.Join(exs[0].Document, " "); !strings.Contains(doc, "subject:hello") {
+		t.Errorf("Expected the headers after the From line to be parsed. Got %q", doc)
+	}
+
+	exs, err = Enron{Dir: filepath.Join(dir, "enron")}.Load(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts := countClasses(exs); counts != [MAXCLASS]int{1, 2} {
+		t.Errorf("Expected 1 ham and 2 spam from Enron. Got %v", counts)
+	}
+	exs, err = Enron{Dir: filepath.Join(dir, "enron", "enron2")}.Load(tok)
+	if err != nil || len(exs) != 1 {
+		t.Errorf("Expected the 1 spam of a single Enron directory. Got %d examples, error %v", len(exs), err)
+	}
+
+	exs, err = CSV{Path: filepath.Join(dir, "spam.csv")}.Load(tok)
+	el, ok := err.(errList)
+	if !ok || len(el) != 1 || !strings.Contains(el[0].Error(), "record 4") {
+		t.Errorf("Expected one error for the unknown label of record 4. Got %v", err)
+	}
+	if counts := countClasses(exs); counts != [MAXCLASS]int{1, 2} {
+		t.Errorf("Expected 1 ham and 2 spam from the CSV. Got %v", counts)
+	}
+
+	if _, err := openDataset("mbox", dir, ""); err == nil {
+		t.Error("Expected an error for an unknown dataset")
+	}
+}
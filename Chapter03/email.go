@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// Email is a parsed RFC 5322 message.
+type Email struct {
+	Header  mail.Header
+	From    string // address of the sender
+	Subject string // decoded subject
+	Text    string // text of the body. HTML is converted to text, attachments are left out
+	Links   int    // number of links in the body
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// ParseEmail reads a message, decoding its MIME structure.
+func ParseEmail(r io.Reader) (*Email, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Email{Header: msg.Header}
+	subject := msg.Header.Get("Subject")
+	if e.Subject, err = wordDecoder.DecodeHeader(subject); err != nil {
+		e.Subject = subject
+	}
+	if from := msg.Header.Get("From"); from != "" {
+		parser := mail.AddressParser{WordDecoder: wordDecoder}
+		if addr, err := parser.Parse(from); err == nil {
+			e.From = addr.Address
+		} else {
+			e.From = from
+		}
+	}
+
+	e.Text, e.Links, err = readPart(textproto.MIMEHeader(msg.Header), msg.Body)
+	return e, err
+}
+
+// SenderDomain is the lowercased domain of the sender's address.
+func (e *Email) SenderDomain() string {
+	at := strings.LastIndex(e.From, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.Trim(e.From[at+1:], "<> "))
+}
+
+// Document tokenizes the email for the classifier. The words of the subject and the body
+// are preceded by features of the headers: the sender's domain, the words of the subject
+// marked as such, and the number of links in the body.
+func (e *Email) Document(tok *Tokenizer) []string {
+	var retVal []string
+	if domain := e.SenderDomain(); domain != "" {
+		retVal = append(retVal, "from:"+domain)
+	}
+	subject := tok.Tokenize(e.Subject)
+	for _, word := range subject {
+		retVal = append(retVal, "subject:"+word)
+	}
+	retVal = append(retVal, linksFeature(e.Links))
+	retVal = append(retVal, subject...)
+	return append(retVal, tok.Tokenize(e.Text)...)
+}
+
+// mailDocument tokenizes a raw message as an email, or as plain text if it cannot be parsed.
+func mailDocument(msg []byte, tok *Tokenizer) []string {
+	if e, err := ParseEmail(bytes.NewReader(msg)); err == nil {
+		return e.Document(tok)
+	}
+	return tok.Tokenize(string(msg))
+}
+
+// linksFeature buckets the number of links.
+func linksFeature(n int) string { return countFeature("links", n) }
+
+// readPart returns the text of a MIME part and the number of links in it.
+func readPart(h textproto.MIMEHeader, body io.Reader) (text string, links int, err error) {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		// RFC 2045: the default is plain US-ASCII text
+		mediaType, params, err = "text/plain", nil, nil
+	}
+	if disp, _, _ := mime.ParseMediaType(h.Get("Content-Disposition")); disp == "attachment" {
+		return "", 0, nil
+	}
+	body = decodeTransfer(h.Get("Content-Transfer-Encoding"), body)
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return readMultipart(mediaType, params["boundary"], body)
+	case mediaType == "message/rfc822":
+		e, err := ParseEmail(body)
+		if err != nil {
+			return "", 0, err
+		}
+		return e.Subject + "\n" + e.Text, e.Links, nil
+	case mediaType == "text/plain", mediaType == "text/html":
+		if cs := params["charset"]; cs != "" {
+			if r, err := charset.NewReaderLabel(cs, body); err == nil {
+				body = r
+			}
+		}
+		bs, err := ioutil.ReadAll(body)
+		if err != nil {
+			return "", 0, err
+		}
+		if mediaType == "text/html" {
+			text, links = htmlToText(bs)
+			return text, links, nil
+		}
+		text = string(bs)
+		return text, len(urlRe.FindAllStringIndex(text, -1)), nil
+	}
+	// images, attachments and the like carry no text.
+	return "", 0, nil
+}
+
+// readMultipart reads every part of a multipart body. Of the parts of a multipart/alternative,
+// only the plain text is kept if there is one.
+func readMultipart(mediaType, boundary string, body io.Reader) (text string, links int, err error) {
+	if boundary == "" {
+		return "", 0, fmt.Errorf("%v without a boundary", mediaType)
+	}
+	var buf bytes.Buffer
+	var alternative string
+	mr := multipart.NewReader(body, boundary)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return buf.String(), links, err
+		}
+		t, l, err := readPart(p.Header, p)
+		if err != nil {
+			return buf.String(), links, err
+		}
+
+		if mediaType != "multipart/alternative" {
+			buf.WriteString(t)
+			buf.WriteByte('\n')
+			links += l
+			continue
+		}
+		if l > links {
+			links = l
+		}
+		if alternative == "" || strings.HasPrefix(p.Header.Get("Content-Type"), "text/plain") && strings.TrimSpace(t) != "" {
+			alternative = t
+		}
+	}
+	if mediaType == "multipart/alternative" {
+		return alternative, links, nil
+	}
+	return buf.String(), links, nil
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	}
+	return r
+}
+
+var urlRe = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// htmlToText strips the markup, scripts and styles from an HTML document, and counts its links.
+func htmlToText(bs []byte) (string, int) {
+	var buf bytes.Buffer
+	var links int
+	var skip int // depth inside <script> and <style>
+	z := html.NewTokenizer(bytes.NewReader(bs))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return buf.String(), links
+		case html.TextToken:
+			if skip == 0 {
+				buf.Write(z.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "script", "style":
+				skip++
+			case "a":
+				for hasAttr {
+					var key []byte
+					key, _, hasAttr = z.TagAttr()
+					if string(key) == "href" {
+						links++
+						break
+					}
+				}
+			case "br", "p", "div", "tr", "li", "h1", "h2", "h3", "h4", "h5", "h6":
+				buf.WriteByte('\n')
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "script", "style":
+				if skip > 0 {
+					skip--
+				}
+			case "p", "div", "tr", "li", "td":
+				buf.WriteByte(' ')
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const multipartEmail = "From: \"=?UTF-8?Q?Caf=C3=A9?=\" <Offers@Example.COM>\r\n" +
+	"Subject: =?UTF-8?B?V2luIGEgcHJpemU=?=\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Claim your caf=C3=A9 voucher at http://example.com/claim\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<html><style>p {}</style><p>Claim your <a href=\"http://example.com/claim\">voucher</a> <a href=\"http://example.com/x\">now</a></p></html>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/html\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"PGI+TGltaXRlZDwvYj4gb2ZmZXI=\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"x.pdf\"\r\n" +
+	"\r\n" +
+	"%PDF-1.4\r\n" +
+	"--outer--\r\n"
+
+func TestParseEmail(t *testing.T) {
+	e, err := ParseEmail(strings.NewReader(multipartEmail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.From != "Offers@Example.COM" || e.SenderDomain() != "example.com" {
+		t.Errorf("Unexpected sender %q (domain %q)", e.From, e.SenderDomain())
+	}
+	if e.Subject != "Win a prize" {
+		t.Errorf("Unexpected subject %q", e.Subject)
+	}
+	if e.Links != 2 {
+		t.Errorf("Expected 2 links. Got %d", e.Links)
+	}
+	words := strings.Fields(e.Text)
+	expected := strings.Fields("Claim your café voucher at http://example.com/claim Limited offer")
+	if !reflect.DeepEqual(words, expected) {
+		t.Errorf("Expected text %q. Got %q", expected, words)
+	}
+
+	doc := e.Document(NewTokenizer(DefaultTokenizerConfig()))
+	for _, feature := range []string{"from:example.com", "subject:win", "links:2-4", "voucher"} {
+		var found bool
+		for _, w := range doc {
+			found = found || w == feature
+		}
+		if !found {
+			t.Errorf("Expected %q in %q", feature, doc)
+		}
+	}
+}
+
+func TestLoadMail(t *testing.T) {
+	dir := t.TempDir()
+	msg := func(subject, body string) string {
+		return "From: a@example.com\nSubject: " + subject + "\n\n" + body + "\n"
+	}
+
+	mbox := "From a@example.com Mon Jan  1 00:00:00 2018\n" + msg("one", "first\n>From the start") +
+		"From a@example.com Mon Jan  1 00:00:00 2018\n" + msg("two", "second")
+	mboxPath := filepath.Join(dir, "spam.mbox")
+	if err := ioutil.WriteFile(mboxPath, []byte(mbox), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exs, err := loadMail(mboxPath, Spam, NewTokenizer(DefaultTokenizerConfig()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exs) != 2 || exs[0].Class != Spam {
+		t.Fatalf("Expected 2 spam examples from the mbox. Got %v", exs)
+	}
+	if doc := strings.Join(exs[0].Document, " "); !strings.HasSuffix(doc, "first from the start") {
+		t.Errorf("Expected the >From quoting to be undone. Got %q", doc)
+	}
+
+	maildir := filepath.Join(dir, "Maildir")
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(maildir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"cur/1:2,S": msg("seen", "hello"),
+		"new/2":     msg("unseen", "hello again"),
+		"tmp/3":     msg("undelivered", "not yet"),
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(maildir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exs, err = loadMail(maildir, Ham, NewTokenizer(DefaultTokenizerConfig()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exs) != 2 {
+		t.Errorf("Expected the 2 delivered messages of the Maildir. Got %d", len(exs))
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"sort"
+	"time"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// scorer is anything that can score a document for each class, like a Classifier.
+type scorer interface {
+	Score(doc []string) [MAXCLASS]float64
+}
+
+// decider is a scorer that makes its own decisions from the scores instead of taking the
+// highest scoring class, like a Classifier with a tuned threshold.
+type decider interface {
+	scorer
+	decide(scores [MAXCLASS]float64) Class
+}
+
+// ClassMetrics are the metrics of one class, treating it as the positive class.
+type ClassMetrics struct {
+	Class     string  `json:"class"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+	Support   int     `json:"support"`
+}
+
+// CurvePoint is a point on a ROC or precision-recall curve. The point is reached by
+// predicting Spam whenever the score margin is at least Threshold.
+type CurvePoint struct {
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Threshold float64 `json:"threshold"`
+}
+
+// Report is the evaluation of a classifier on a set of examples. Spam is the positive class.
+// The curves are traced by the score margin, that is, the score of Spam minus the score of Ham.
+type Report struct {
+	Name     string    `json:"name"`
+	Time     time.Time `json:"time"`
+	Examples int       `json:"examples"`
+
+	// Confusion is indexed by the actual class, then the predicted class.
+	Confusion [MAXCLASS][MAXCLASS]int `json:"confusion"`
+	Classes   []ClassMetrics          `json:"classes"`
+	Accuracy  float64                 `json:"accuracy"`
+
+	// FalsePositiveRate is the fraction of ham that is flagged as spam.
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+
+	ROC    []CurvePoint `json:"roc"` // X is the false positive rate, Y the true positive rate
+	ROCAUC float64      `json:"roc_auc"`
+	PR     []CurvePoint `json:"pr"`     // X is the recall, Y the precision
+	PRAUC  float64      `json:"pr_auc"` // average precision
+}
+
+// evaluate scores every example and builds a report.
+func evaluate(name string, s scorer, examples []Example) Report {
+	decide := argmax
+	if d, ok := s.(decider); ok {
+		decide = d.decide
+	}
+	margins := make([]float64, len(examples))
+	r := Report{Name: name, Time: time.Now(), Examples: len(examples)}
+	for i, ex := range examples {
+		scores := s.Score(ex.Document)
+		margins[i] = scores[Spam] - scores[Ham]
+		r.Confusion[ex.Class][decide(scores)]++
+	}
+	r.summarize()
+	r.curves(examples, margins)
+	return r
+}
+
+// summarize fills in the metrics that are derived from the confusion matrix.
+func (r *Report) summarize() {
+	var corrects, total int
+	r.Classes = r.Classes[:0]
+	for i := Ham; i < MAXCLASS; i++ {
+		var predicted, actual int
+		for j := Ham; j < MAXCLASS; j++ {
+			predicted += r.Confusion[j][i]
+			actual += r.Confusion[i][j]
+		}
+		tp := r.Confusion[i][i]
+		m := ClassMetrics{
+			Class:     i.String(),
+			Precision: ratio(tp, predicted),
+			Recall:    ratio(tp, actual),
+			Support:   actual,
+		}
+		if m.Precision+m.Recall > 0 {
+			m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+		}
+		r.Classes = append(r.Classes, m)
+		corrects += tp
+		total += actual
+	}
+	r.Accuracy = ratio(corrects, total)
+	r.FalsePositiveRate = ratio(r.Confusion[Ham][Spam], r.Confusion[Ham][Ham]+r.Confusion[Ham][Spam])
+}
+
+// curves traces the ROC and precision-recall curves by sweeping the decision threshold
+// over the margins, from the most spammy example down.
+func (r *Report) curves(examples []Example, margins []float64) {
+	order := make([]int, len(examples))
+	var positives, negatives int
+	for i, ex := range examples {
+		order[i] = i
+		if ex.Class == Spam {
+			positives++
+		} else {
+			negatives++
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return margins[order[i]] > margins[order[j]] })
+
+	r.ROC = []CurvePoint{{X: 0, Y: 0, Threshold: math.MaxFloat64}}
+	r.PR = r.PR[:0]
+	r.ROCAUC, r.PRAUC = 0, 0
+	var tp, fp int
+	for k, i := range order {
+		if examples[i].Class == Spam {
+			tp++
+		} else {
+			fp++
+		}
+		// examples with the same margin cannot be separated by a threshold
+		if k+1 < len(order) && margins[order[k+1]] == margins[i] {
+			continue
+		}
+		threshold := finite(margins[i])
+		prev := r.ROC[len(r.ROC)-1]
+		roc := CurvePoint{X: ratio(fp, negatives), Y: ratio(tp, positives), Threshold: threshold}
+		r.ROCAUC += (roc.X - prev.X) * (roc.Y + prev.Y) / 2
+		r.ROC = append(r.ROC, roc)
+
+		pr := CurvePoint{X: ratio(tp, positives), Y: ratio(tp, tp+fp), Threshold: threshold}
+		r.PRAUC += (roc.Y - prev.Y) * pr.Y
+		r.PR = append(r.PR, pr)
+	}
+}
+
+func (r Report) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s: %d examples. Accuracy %.4f. False positive rate %.4f\n", r.Name, r.Examples, r.Accuracy, r.FalsePositiveRate)
+	fmt.Fprintf(&buf, "\tConfusion (rows: actual, columns: predicted)\n\t\t%8v%8v\n", Ham, Spam)
+	for i := Ham; i < MAXCLASS; i++ {
+		fmt.Fprintf(&buf, "\t%8v%8d%8d\n", i, r.Confusion[i][Ham], r.Confusion[i][Spam])
+	}
+	for _, m := range r.Classes {
+		fmt.Fprintf(&buf, "\t%-5s Precision %.4f Recall %.4f F1 %.4f Support %d\n", m.Class, m.Precision, m.Recall, m.F1, m.Support)
+	}
+	fmt.Fprintf(&buf, "\tROC AUC %.4f. PR AUC %.4f\n", r.ROCAUC, r.PRAUC)
+	return buf.String()
+}
+
+// writeJSON writes the reports to a file, so results can be tracked over time.
+func writeJSON(filename string, reports ...Report) error {
+	bs, err := json.MarshalIndent(reports, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, bs, 0644)
+}
+
+// plotCurves draws the ROC curves of the reports to one file and their precision-recall curves to another.
+func plotCurves(rocFilename, prFilename string, reports ...Report) error {
+	roc, err := newCurvePlot("ROC", "False Positive Rate", "True Positive Rate")
+	if err != nil {
+		return err
+	}
+	pr, err := newCurvePlot("Precision-Recall", "Recall", "Precision")
+	if err != nil {
+		return err
+	}
+	pr.Legend.Left = true
+
+	diag, err := plotter.NewLine(plotter.XYs{{X: 0, Y: 0}, {X: 1, Y: 1}})
+	if err != nil {
+		return err
+	}
+	diag.LineStyle.Color = color.Gray{Y: 192}
+	diag.LineStyle.Dashes = []vg.Length{vg.Points(2), vg.Points(2)}
+	roc.Add(diag)
+
+	for i, r := range reports {
+		for _, c := range []struct {
+			p      *plot.Plot
+			points []CurvePoint
+			auc    float64
+		}{{roc, r.ROC, r.ROCAUC}, {pr, r.PR, r.PRAUC}} {
+			xys := make(plotter.XYs, len(c.points))
+			for j, pt := range c.points {
+				xys[j].X, xys[j].Y = pt.X, pt.Y
+			}
+			l, err := plotter.NewLine(xys)
+			if err != nil {
+				return err
+			}
+			l.LineStyle.Color = curveColors[i%len(curveColors)]
+			c.p.Add(l)
+			c.p.Legend.Add(fmt.Sprintf("%s (AUC %.3f)", r.Name, c.auc), l)
+		}
+	}
+
+	if err := roc.Save(15*vg.Centimeter, 15*vg.Centimeter, rocFilename); err != nil {
+		return err
+	}
+	return pr.Save(15*vg.Centimeter, 15*vg.Centimeter, prFilename)
+}
+
+var curveColors = []color.Color{
+	color.RGBA{A: 255},
+	color.RGBA{R: 228, G: 26, B: 28, A: 255},
+	color.RGBA{R: 55, G: 126, B: 184, A: 255},
+	color.RGBA{R: 77, G: 175, B: 74, A: 255},
+	color.RGBA{R: 152, G: 78, B: 163, A: 255},
+	color.RGBA{R: 255, G: 127, B: 0, A: 255},
+}
+
+func newCurvePlot(title, x, y string) (*plot.Plot, error) {
+	p, err := plot.New()
+	if err != nil {
+		return nil, err
+	}
+	p.Title.Text = title
+	p.X.Label.Text = x
+	p.Y.Label.Text = y
+	p.X.Min, p.X.Max = 0, 1
+	p.Y.Min, p.Y.Max = 0, 1
+	return p, nil
+}
+
+// ratio is a/b, or 0 if b is 0.
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+// finite clamps infinities so that the value can be encoded as JSON.
+func finite(a float64) float64 {
+	switch {
+	case math.IsInf(a, 1):
+		return math.MaxFloat64
+	case math.IsInf(a, -1):
+		return -math.MaxFloat64
+	}
+	return a
+}
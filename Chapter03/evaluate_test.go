@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// marginScorer scores a document consisting of a single number with that number as the margin.
+type marginScorer struct{}
+
+func (marginScorer) Score(doc []string) (retVal [MAXCLASS]float64) {
+	m, _ := strconv.ParseFloat(doc[0], 64)
+	retVal[Spam] = m
+	return
+}
+
+func TestEvaluate(t *testing.T) {
+	examples := []Example{
+		{[]string{"3"}, Spam},
+		{[]string{"2"}, Spam},
+		{[]string{"1"}, Ham},
+		{[]string{"-1"}, Spam},
+		{[]string{"-2"}, Ham},
+		{[]string{"-3"}, Ham},
+	}
+	r := evaluate("test", marginScorer{}, examples)
+
+	if r.Confusion != [MAXCLASS][MAXCLASS]int{{2, 1}, {1, 2}} {
+		t.Errorf("Unexpected confusion matrix %v", r.Confusion)
+	}
+	if r.Accuracy != 4.0/6.0 {
+		t.Errorf("Expected accuracy 4/6. Got %v", r.Accuracy)
+	}
+	if r.FalsePositiveRate != 1.0/3.0 {
+		t.Errorf("Expected a false positive rate of 1/3. Got %v", r.FalsePositiveRate)
+	}
+	spam := r.Classes[Spam]
+	if spam.Precision != 2.0/3.0 || spam.Recall != 2.0/3.0 || math.Abs(spam.F1-2.0/3.0) > 1e-12 {
+		t.Errorf("Unexpected spam metrics %+v", spam)
+	}
+	// 8 of the 9 spam-ham pairs are ordered correctly
+	if math.Abs(r.ROCAUC-8.0/9.0) > 1e-12 {
+		t.Errorf("Expected ROC AUC of 8/9. Got %v", r.ROCAUC)
+	}
+	// precision at each spam: 1, 1, 3/4
+	if ap := (1 + 1 + 0.75) / 3; math.Abs(r.PRAUC-ap) > 1e-12 {
+		t.Errorf("Expected PR AUC of %v. Got %v", ap, r.PRAUC)
+	}
+
+	if _, err := json.Marshal(r); err != nil {
+		t.Errorf("Unable to encode report: %v", err)
+	}
+	dir := t.TempDir()
+	if err := plotCurves(filepath.Join(dir, "roc.png"), filepath.Join(dir, "pr.png"), r); err != nil {
+		t.Errorf("Unable to plot curves: %v", err)
+	}
+}
+
+func TestCrossValidate(t *testing.T) {
+	var examples []Example
+	for i := 0; i < 20; i++ {
+		examples = append(examples, toyExamples...)
+	}
+	if _, err := stratifiedFolds(examples, 0, rand.New(rand.NewSource(1))); err == nil {
+		t.Errorf("Expected an error for 0 folds")
+	}
+	folds, err := stratifiedFolds(examples, 5, rand.New(rand.NewSource(1)))
+	if err != nil || len(folds) != 5 {
+		t.Fatalf("Expected 5 folds. Got %d, %v", len(folds), err)
+	}
+	for i, fold := range folds {
+		var spams int
+		for _, ex := range fold {
+			if ex.Class == Spam {
+				spams++
+			}
+		}
+		if len(fold) != 24 || spams != 12 {
+			t.Errorf("Fold %d: expected 12 of 24 examples to be spam. Got %d of %d", i, spams, len(fold))
+		}
+	}
+
+	reports, err := crossValidate("toy", folds, func() trainer { return New() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	avg := averageReports("toy", reports)
+	if avg.Examples != len(examples) || avg.Accuracy != 1 {
+		t.Errorf("Expected perfect accuracy over %d examples. Got %v over %d", len(examples), avg.Accuracy, avg.Examples)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// TokenContribution is what a token contributes to the log score of each class.
+type TokenContribution struct {
+	Token string
+	Count int // number of times the token occurs in the document
+
+	// LogLikelihood is the total contribution of the token to each class, as computed by the model.
+	LogLikelihood [MAXCLASS]float64
+
+	// Weight is how strongly the token pushes towards the class it is listed under: its
+	// contribution to that class minus its average contribution to the other classes.
+	Weight float64
+}
+
+// Explanation breaks the scores of a document down into the contribution of each token.
+// For every class, Scores = Prior + Base + the sum of the LogLikelihood of every token.
+type Explanation struct {
+	Class  Class
+	Scores [MAXCLASS]float64
+	Prior  [MAXCLASS]float64 // log prior
+
+	// Base is the part of the score that does not come from any one token, such as the
+	// absent words of the Bernoulli model.
+	Base [MAXCLASS]float64
+
+	// Top lists the tokens pushing towards each class, strongest first.
+	Top [MAXCLASS][]TokenContribution
+}
+
+// presenceModel is implemented by models where only the presence of a word counts, not how often it occurs.
+type presenceModel interface {
+	presence()
+}
+
+func (*bernoulli) presence() {}
+
+// Explain scores the document and explains the scores. At most k tokens are listed for each class.
+func (c *Classifier) Explain(doc []string, k int) Explanation {
+	c.rlockReady()
+	defer c.RUnlock()
+
+	var e Explanation
+	priors := c.priors()
+	d := c.lookup(doc)
+	for i := range e.Scores {
+		e.Prior[i] = math.Log(priors[i])
+		e.Scores[i] = e.Prior[i] + c.model.logLikelihood(c, d, Class(i))
+	}
+	e.Class = c.decide(e.Scores)
+
+	counts := make(map[string]int)
+	var order []string
+	for _, word := range doc {
+		if counts[word] == 0 {
+			order = append(order, word)
+		}
+		counts[word]++
+	}
+	_, presence := c.model.(presenceModel)
+
+	e.Base = e.Scores
+	var contribs []TokenContribution
+	for _, word := range order {
+		tc := TokenContribution{Token: word, Count: counts[word]}
+		n := float64(tc.Count)
+		if presence {
+			n = 1
+		}
+		id := c.wordID(word)
+		for i := range tc.LogLikelihood {
+			tc.LogLikelihood[i] = n * c.model.logProb(c, id, Class(i))
+			e.Base[i] -= tc.LogLikelihood[i]
+		}
+		contribs = append(contribs, tc)
+	}
+	for i := range e.Base {
+		e.Base[i] -= e.Prior[i]
+	}
+
+	for i := range e.Top {
+		var top []TokenContribution
+		for _, tc := range contribs {
+			var others float64
+			for j := range tc.LogLikelihood {
+				if j != i {
+					others += tc.LogLikelihood[j]
+				}
+			}
+			tc.Weight = tc.LogLikelihood[i] - others/float64(MAXCLASS-1)
+			if tc.Weight > 0 {
+				top = append(top, tc)
+			}
+		}
+		sort.SliceStable(top, func(a, b int) bool { return top[a].Weight > top[b].Weight })
+		if len(top) > k {
+			top = top[:k]
+		}
+		e.Top[i] = top
+	}
+	return e
+}
+
+func (e Explanation) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Predicted: %v\n", e.Class)
+	for i := Ham; i < MAXCLASS; i++ {
+		fmt.Fprintf(&buf, "%v: Score %.4f = Prior %.4f + Base %.4f + Tokens %.4f\n", i, e.Scores[i], e.Prior[i], e.Base[i], e.Scores[i]-e.Prior[i]-e.Base[i])
+	}
+	for i := Ham; i < MAXCLASS; i++ {
+		fmt.Fprintf(&buf, "Tokens pushing towards %v:\n", i)
+		for _, tc := range e.Top[i] {
+			fmt.Fprintf(&buf, "\t%-20s\t×%d\t%+.4f\t%v\n", tc.Token, tc.Count, tc.Weight, tc.LogLikelihood)
+		}
+	}
+	return buf.String()
+}
+
+// Annotate marks the words of the text whose tokens are among the top tokens of the explanation:
+// {+word+} pushes towards Spam, and [-word-] towards Ham.
+func (e Explanation) Annotate(text string, tok *Tokenizer) string {
+	// only the words of each field are looked up, not the features added to them.
+	plain := NewTokenizer(tok.TokenizerConfig)
+	plain.NGrams, plain.CharNGrams, plain.Patterns = 0, 0, false
+
+	strongest := make(map[string]Class)
+	for i := range e.Top {
+		for _, tc := range e.Top[i] {
+			strongest[tc.Token] = Class(i)
+		}
+	}
+
+	var buf bytes.Buffer
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		for j, field := range strings.Fields(line) {
+			if j > 0 {
+				buf.WriteByte(' ')
+			}
+			class, ok := MAXCLASS, false
+			for _, token := range plain.Tokenize(field) {
+				if class, ok = strongest[token]; ok {
+					break
+				}
+			}
+			switch {
+			case !ok:
+				buf.WriteString(field)
+			case class == Spam:
+				fmt.Fprintf(&buf, "{+%s+}", field)
+			default:
+				fmt.Fprintf(&buf, "[-%s-]", field)
+			}
+		}
+	}
+	return buf.String()
+}
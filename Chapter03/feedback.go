@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Correction is a user's verdict on a message, as recorded in the audit log.
+type Correction struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user,omitempty"`
+	Class    string    `json:"class"`    // "spam" or "ham"
+	Previous string    `json:"previous"` // what the classifier predicted before the correction
+	Message  string    `json:"message,omitempty"`
+}
+
+// FeedbackStore trains a classifier on corrections as they come in, and appends every correction
+// to an audit log of JSON lines, from which the corrections can be replayed with ReplayFeedback.
+type FeedbackStore struct {
+	// SaveTo is the file the classifier is saved to after every correction. It is not saved if empty.
+	SaveTo string
+
+	c   *Classifier
+	log *os.File
+	sync.Mutex
+}
+
+// OpenFeedback opens the audit log at path for appending, creating it if needed.
+func OpenFeedback(c *Classifier, path string) (*FeedbackStore, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to open the feedback log")
+	}
+	return &FeedbackStore{c: c, log: f}, nil
+}
+
+// Correct records that the raw message is of the given class, and trains the classifier on it.
+// The correction is logged before the classifier is trained, so that a logged correction is
+// never lost from a replay.
+func (fs *FeedbackStore) Correct(msg []byte, class Class, user string) (Correction, error) {
+	doc := mailDocument(msg, NewTokenizer(fs.c.Tokenizer))
+	corr := Correction{
+		Time:     time.Now().UTC(),
+		User:     user,
+		Class:    strings.ToLower(class.String()),
+		Previous: strings.ToLower(fs.c.Predict(doc).String()),
+		Message:  string(msg),
+	}
+	line, err := json.Marshal(corr)
+	if err != nil {
+		return corr, err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+	if _, err := fs.log.Write(append(line, '\n')); err != nil {
+		return corr, errors.Wrap(err, "Unable to log the correction")
+	}
+	if err := fs.log.Sync(); err != nil {
+		return corr, errors.Wrap(err, "Unable to log the correction")
+	}
+	fs.c.Train([]Example{{doc, class}})
+	if fs.SaveTo != "" {
+		if err := fs.c.SaveFile(fs.SaveTo); err != nil {
+			return corr, err
+		}
+	}
+	return corr, nil
+}
+
+// Close closes the audit log.
+func (fs *FeedbackStore) Close() error { return fs.log.Close() }
+
+// ServeHTTP takes corrections by HTTP: a POST of the raw message, with the class given by the
+// class query parameter ("spam" or "ham"), and optionally the user by the user parameter. It
+// replies with the correction, without the message.
+func (fs *FeedbackStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	class, ok := parseLabel(r.URL.Query().Get("class"))
+	if !ok {
+		http.Error(w, "Expected class=spam or class=ham", http.StatusBadRequest)
+		return
+	}
+	msg, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 10<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(msg) == 0 {
+		http.Error(w, "Expected the raw message as the body", http.StatusBadRequest)
+		return
+	}
+
+	corr, err := fs.Correct(msg, class, r.URL.Query().Get("user"))
+	if err != nil {
+		log.Printf("Unable to apply correction: %v", err)
+		http.Error(w, "Unable to apply correction", http.StatusInternalServerError)
+		return
+	}
+	corr.Message = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corr)
+}
+
+// ReplayFeedback trains the classifier on every correction in an audit log, in order. It returns
+// the number of corrections replayed.
+func ReplayFeedback(r io.Reader, c *Classifier) (n int, err error) {
+	tok := NewTokenizer(c.Tokenizer)
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16<<20)
+	for line := 1; s.Scan(); line++ {
+		if len(strings.TrimSpace(s.Text())) == 0 {
+			continue
+		}
+		var corr Correction
+		if err := json.Unmarshal(s.Bytes(), &corr); err != nil {
+			return n, errors.Wrapf(err, "Feedback line %d", line)
+		}
+		class, ok := parseLabel(corr.Class)
+		if !ok {
+			return n, errors.Errorf("Feedback line %d: unknown class %q", line, corr.Class)
+		}
+		c.Train([]Example{{mailDocument([]byte(corr.Message), tok), class}})
+		n++
+	}
+	return n, s.Err()
+}
+
+// ReplayFeedbackFile replays the audit log in the named file.
+func ReplayFeedbackFile(filename string, c *Classifier) (int, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return ReplayFeedback(f, c)
+}
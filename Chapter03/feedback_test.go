@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestFeedback(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "feedback.jsonl")
+	c, err := Construct(WithModel("multinomial"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Train(toyExamples)
+
+	fs, err := OpenFeedback(c, logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.SaveTo = filepath.Join(dir, "model.gob")
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+
+	msg := "From: a@example.com\nSubject: seminar\n\nthe linguistics seminar is cheap now\n"
+	doc := mailDocument([]byte(msg), NewTokenizer(c.Tokenizer))
+	before := c.Score(doc)
+
+	resp, err := http.Post(srv.URL+"?class=spam&user=alice", "message/rfc822", bytes.NewBufferString(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corr Correction
+	if err := json.NewDecoder(resp.Body).Decode(&corr); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || corr.Class != "spam" || corr.User != "alice" || corr.Message != "" {
+		t.Errorf("Unexpected response %v: %+v", resp.Status, corr)
+	}
+	after := c.Score(doc)
+	if after[Spam]-after[Ham] <= before[Spam]-before[Ham] {
+		t.Errorf("Expected the correction to move the message towards spam. Before %v, after %v", before, after)
+	}
+
+	for _, bad := range []string{"?class=maybe", "?class=ham"} {
+		resp, err := http.Post(srv.URL+bad, "text/plain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: expected %d. Got %v", bad, http.StatusBadRequest, resp.Status)
+		}
+	}
+	if _, err := fs.Correct([]byte("cheap viagra"), Ham, ""); err != nil {
+		t.Fatal(err)
+	}
+	fs.Close()
+
+	// replaying the log onto the original training rebuilds the corrected model.
+	saved, err := LoadFile(fs.SaveTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, _ := Construct(WithModel("multinomial"))
+	rebuilt.Train(toyExamples)
+	n, err := ReplayFeedbackFile(logPath, rebuilt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 corrections to be replayed. Got %d", n)
+	}
+	if !closeScores(rebuilt.Score(doc), saved.Score(doc)) || !closeScores(rebuilt.Score(doc), c.Score(doc)) {
+		t.Errorf("Expected the replayed model to score %v. Got %v", c.Score(doc), rebuilt.Score(doc))
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"hash/fnv"
+
+	"github.com/pkg/errors"
+)
+
+// WithHashing makes the classifier hash words into a fixed number of buckets instead of
+// keeping a vocabulary, so that its memory stays bounded however many new words it sees.
+//
+// Signed hashing, where each word also hashes to a sign so that colliding words tend to cancel
+// out rather than add up (Weinberger et al. 2009), needs features that can be negative. The
+// models of a Classifier count words, so it is rejected.
+func WithHashing(buckets int, signed bool) ConsOpt {
+	return func(c *Classifier) error {
+		if buckets <= 0 {
+			return errors.Errorf("The number of buckets has to be positive. Got %d", buckets)
+		}
+		if signed {
+			return errors.New("Signed hashing is meaningless for the word counts the models are built on")
+		}
+		c.Buckets = buckets
+		return nil
+	}
+}
+
+// hashed reports whether the classifier uses hashed features instead of a vocabulary.
+func (c *Classifier) hashed() bool { return c.Buckets > 0 }
+
+// bucket returns the bucket of a word.
+func (c *Classifier) bucket(word string) int {
+	h := fnv.New64a()
+	h.Write([]byte(word))
+	return int(h.Sum64() % uint64(c.Buckets))
+}
+
+// hashDoc hashes the words of a sentence into a document of bucket IDs, one for every word.
+func (c *Classifier) hashDoc(sentence []string) doc {
+	d := make(doc, len(sentence))
+	for i, word := range sentence {
+		d[i] = c.bucket(word)
+	}
+	return d
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestHashing(t *testing.T) {
+	c, err := Construct(WithModel("multinomial"), WithHashing(1<<10, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := c.corpus.Size()
+	c.Train(toyExamples)
+	if c.corpus.Size() != size {
+		t.Errorf("Expected the corpus to stay at %d words. Got %d", size, c.corpus.Size())
+	}
+	for _, ex := range toyExamples {
+		if got := c.Predict(ex.Document); got != ex.Class {
+			t.Errorf("Expected %v for %q. Got %v", ex.Class, ex.Document, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Buckets != c.Buckets {
+		t.Errorf("Expected the hashing configuration to be loaded. Got %+v", loaded.Config)
+	}
+	doc := toyExamples[0].Document
+	if !closeScores(loaded.Score(doc), c.Score(doc)) {
+		t.Errorf("Loaded classifier scores %v. Expected %v", loaded.Score(doc), c.Score(doc))
+	}
+
+	if _, err := Construct(WithHashing(0, false)); err == nil {
+		t.Error("Expected an error for 0 buckets")
+	}
+	if _, err := Construct(WithHashing(1<<10, true)); err == nil {
+		t.Error("Expected an error for signed hashing of word counts")
+	}
+}
+
+// BenchmarkHashing compares the memory and accuracy of a vocabulary against hashed features on
+// lingspam, training on parts 1-7 and testing on parts 8-10, as -compare does. heap-B is the
+// memory held by a trained classifier.
+func BenchmarkHashing(b *testing.B) {
+	if _, err := os.Stat("data/lingspam_public"); err != nil {
+		b.Skip("lingspam is not available")
+	}
+	tok := NewTokenizer(DefaultTokenizerConfig())
+	train, err := ingestParts("lemm_stop", tok, 0, 8)
+	if err != nil {
+		b.Fatal(err)
+	}
+	test, err := ingestParts("lemm_stop", tok, 8, 11)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	configs := []struct {
+		name string
+		opts []ConsOpt
+	}{
+		{"vocabulary", nil},
+		{"buckets=1024", []ConsOpt{WithHashing(1<<10, false)}},
+		{"buckets=16384", []ConsOpt{WithHashing(1<<14, false)}},
+		{"buckets=262144", []ConsOpt{WithHashing(1<<18, false)}},
+	}
+	for _, conf := range configs {
+		b.Run(conf.name, func(b *testing.B) {
+			var heap, accuracy float64
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				c, err := Construct(append([]ConsOpt{WithModel("multinomial")}, conf.opts...)...)
+				if err != nil {
+					b.Fatal(err)
+				}
+				c.Train(train)
+				c.Postprocess()
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				heap += float64(after.HeapAlloc) - float64(before.HeapAlloc)
+				accuracy += evaluate(conf.name, c, test).Accuracy
+			}
+			b.ReportMetric(heap/float64(b.N), "heap-B")
+			b.ReportMetric(accuracy/float64(b.N), "accuracy")
+		})
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/chewxy/lingo/corpus"
+	"github.com/pkg/errors"
+)
+
+// LinearModels lists the names of the available linear models.
+var LinearModels = []string{"logistic", "svm"}
+
+// LinearConfig holds the settings of a Linear classifier.
+type LinearConfig struct {
+	// Loss is "logistic" for logistic regression, or "hinge" for a linear SVM trained with Pegasos.
+	Loss string
+
+	// Lambda is the strength of the L2 regularization.
+	Lambda float64
+
+	// Epochs is the number of passes over the examples each call to Train makes.
+	Epochs int
+
+	// LearningRate is the initial learning rate of logistic regression. Pegasos sets its own.
+	LearningRate float64
+
+	// Seed seeds the order the examples are visited in.
+	Seed int64
+
+	// Tokenizer is how raw text is turned into words.
+	Tokenizer TokenizerConfig
+}
+
+// Linear is a linear classifier over sparse bag of words features: logistic regression or
+// a linear SVM. It is trained by stochastic gradient descent, and like Classifier it may be
+// trained more than once; each call to Train continues from the weights learned so far.
+//
+// A document is represented by the set of its words, normalized to unit length.
+type Linear struct {
+	LinearConfig
+	corpus *corpus.Corpus
+
+	// the weights are w = scale·v, so that the L2 decay of every step is a single multiplication.
+	// v[0] is the bias, which is the weight of a feature that is always 1.
+	v     []float64
+	scale float64
+	steps float64 // number of SGD steps taken
+
+	// plattA and plattB map the margin f of the SVM to P(Spam) = 1 / (1 + exp(A·f + B)).
+	// They are fitted to the margins of the training examples held out by cross validation.
+	plattA, plattB float64
+
+	rand *rand.Rand
+	sync.RWMutex
+}
+
+// LinearOpt is a construction option for a Linear classifier.
+type LinearOpt func(l *Linear) error
+
+// WithLoss sets the loss of the linear classifier by model name: "logistic" or "svm".
+func WithLoss(name string) LinearOpt {
+	return func(l *Linear) error {
+		switch name {
+		case "logistic":
+			l.Loss = "logistic"
+		case "svm", "hinge":
+			l.Loss = "hinge"
+		default:
+			return errors.Errorf("Unknown linear model %q. Expected one of %v", name, LinearModels)
+		}
+		return nil
+	}
+}
+
+// WithRegularization sets the strength of the L2 regularization.
+func WithRegularization(lambda float64) LinearOpt {
+	return func(l *Linear) error {
+		if lambda <= 0 {
+			return errors.Errorf("Lambda has to be positive. Got %v", lambda)
+		}
+		l.Lambda = lambda
+		return nil
+	}
+}
+
+// WithEpochs sets the number of passes over the examples.
+func WithEpochs(epochs int) LinearOpt {
+	return func(l *Linear) error {
+		if epochs <= 0 {
+			return errors.Errorf("Epochs has to be positive. Got %d", epochs)
+		}
+		l.Epochs = epochs
+		return nil
+	}
+}
+
+// WithSeed seeds the order the examples are visited in.
+func WithSeed(seed int64) LinearOpt {
+	return func(l *Linear) error {
+		l.Seed = seed
+		l.rand = rand.New(rand.NewSource(seed))
+		return nil
+	}
+}
+
+// WithLinearTokenizer sets how the linear classifier tokenizes raw text.
+func WithLinearTokenizer(conf TokenizerConfig) LinearOpt {
+	return func(l *Linear) error {
+		l.Tokenizer = conf
+		return nil
+	}
+}
+
+// ConstructLinear creates a linear classifier with the given options. By default it is
+// logistic regression.
+func ConstructLinear(opts ...LinearOpt) (*Linear, error) {
+	l := &Linear{
+		LinearConfig: LinearConfig{
+			Loss:         "logistic",
+			Lambda:       1e-4,
+			Epochs:       5,
+			LearningRate: 0.5,
+			Seed:         1,
+			Tokenizer:    DefaultTokenizerConfig(),
+		},
+		corpus: corpus.New(),
+		v:      make([]float64, 1),
+		scale:  1,
+		plattA: -1,
+		rand:   rand.New(rand.NewSource(1)),
+	}
+	for _, opt := range opts {
+		if err := opt(l); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// feature is an entry of a sparse feature vector. Index 0 is the bias.
+type feature struct {
+	index int
+	value float64
+}
+
+// features turns a document into its sparse feature vector. When add is true, new words are
+// added to the vocabulary; otherwise they are ignored.
+func (l *Linear) features(document []string, add bool) []feature {
+	seen := make(map[int]struct{}, len(document))
+	x := []feature{{0, 1}}
+	for _, word := range document {
+		var id int
+		if add {
+			id = l.corpus.Add(word)
+		} else {
+			var ok bool
+			if id, ok = l.corpus.Id(word); !ok {
+				continue
+			}
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		x = append(x, feature{index: id + 1})
+	}
+	norm := 1 / math.Sqrt(float64(len(x)-1))
+	for i := range x[1:] {
+		x[i+1].value = norm
+	}
+	return x
+}
+
+// margin is w·x.
+func (l *Linear) margin(x []feature) (retVal float64) {
+	for _, f := range x {
+		if f.index < len(l.v) {
+			retVal += l.v[f.index] * f.value
+		}
+	}
+	return retVal * l.scale
+}
+
+// Train fits the classifier to the examples with Epochs passes of stochastic gradient descent.
+func (l *Linear) Train(examples []Example) {
+	l.Lock()
+	defer l.Unlock()
+
+	xs := make([][]feature, len(examples))
+	ys := make([]float64, len(examples))
+	for i, ex := range examples {
+		xs[i] = l.features(ex.Document, true)
+		ys[i] = -1
+		if ex.Class == Spam {
+			ys[i] = 1
+		}
+	}
+	if n := l.corpus.Size() + 1; n > len(l.v) {
+		l.v = append(l.v, make([]float64, n-len(l.v))...)
+	}
+
+	order := make([]int, len(examples))
+	for i := range order {
+		order[i] = i
+	}
+	l.descend(xs, ys, order)
+
+	if l.Loss == "hinge" {
+		l.plattA, l.plattB = plattScaling(l.heldOutMargins(xs, ys), ys)
+	}
+}
+
+// descend takes Epochs passes of SGD over the examples of xs and ys listed in order.
+func (l *Linear) descend(xs [][]feature, ys []float64, order []int) {
+	for epoch := 0; epoch < l.Epochs; epoch++ {
+		l.rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		for _, i := range order {
+			l.step(xs[i], ys[i])
+		}
+	}
+}
+
+// plattFolds is the number of folds the margins Platt scaling is fitted to are held out by.
+const plattFolds = 5
+
+// heldOutMargins returns the margin of every example under a model trained from scratch on the
+// other folds, as Platt (1999) recommends: the margins of the examples a model was trained on are
+// biased towards the right side, and would make the probabilities overconfident.
+func (l *Linear) heldOutMargins(xs [][]feature, ys []float64) []float64 {
+	r := rand.New(rand.NewSource(l.Seed))
+	fold := r.Perm(len(xs))
+	margins := make([]float64, len(xs))
+	for k := 0; k < plattFolds; k++ {
+		m := &Linear{LinearConfig: l.LinearConfig, v: make([]float64, len(l.v)), scale: 1, rand: r}
+		var order []int
+		for i := range xs {
+			if fold[i]%plattFolds != k {
+				order = append(order, i)
+			}
+		}
+		m.descend(xs, ys, order)
+		for i, x := range xs {
+			if fold[i]%plattFolds == k {
+				margins[i] = m.margin(x)
+			}
+		}
+	}
+	return margins
+}
+
+// step takes one SGD step on the example (x, y), where y is ±1.
+func (l *Linear) step(x []feature, y float64) {
+	l.steps++
+	var eta, g float64
+	m := y * l.margin(x)
+	switch l.Loss {
+	case "hinge":
+		// Pegasos (Shalev-Shwartz et al. 2007)
+		eta = 1 / (l.Lambda * l.steps)
+		if m < 1 {
+			g = y
+		}
+	default:
+		// the learning rate schedule of Bottou (2012)
+		eta = l.LearningRate / (1 + l.LearningRate*l.Lambda*l.steps)
+		g = y * sigmoid(-m)
+	}
+
+	l.scale *= 1 - eta*l.Lambda
+	if l.scale < 1e-9 {
+		// fold the scale back into the weights before it underflows.
+		for i := range l.v {
+			l.v[i] *= l.scale
+		}
+		l.scale = 1
+	}
+	if g != 0 {
+		for _, f := range x {
+			l.v[f.index] += eta * g * f.value / l.scale
+		}
+	}
+}
+
+// Prob is the calibrated probability that the document is spam.
+func (l *Linear) Prob(document []string) float64 {
+	l.RLock()
+	defer l.RUnlock()
+	return sigmoid(l.logit(l.margin(l.features(document, false))))
+}
+
+// logit is the log odds of Spam given the margin.
+func (l *Linear) logit(margin float64) float64 {
+	if l.Loss == "hinge" {
+		return -(l.plattA*margin + l.plattB)
+	}
+	return margin
+}
+
+// Score returns the log probability of each class given the document.
+func (l *Linear) Score(document []string) (scores [MAXCLASS]float64) {
+	l.RLock()
+	defer l.RUnlock()
+	logit := l.logit(l.margin(l.features(document, false)))
+	scores[Spam] = logSigmoid(logit)
+	scores[Ham] = logSigmoid(-logit)
+	return
+}
+
+// Predict returns the most probable class of the document.
+func (l *Linear) Predict(document []string) Class { return argmax(l.Score(document)) }
+
+func sigmoid(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+
+// logSigmoid is log(sigmoid(x)), without overflowing for large |x|.
+func logSigmoid(x float64) float64 {
+	if x < 0 {
+		return x - math.Log1p(math.Exp(x))
+	}
+	return -math.Log1p(math.Exp(-x))
+}
+
+// plattScaling fits P(y=1|f) = 1 / (1 + exp(A·f + B)) to the margins f and labels y (±1) by
+// maximum likelihood, with the Newton method and the regularized targets of Lin, Lin and
+// Weng (2007), "A note on Platt's probabilistic outputs for support vector machines".
+func plattScaling(f, y []float64) (A, B float64) {
+	var prior1, prior0 float64
+	for _, label := range y {
+		if label > 0 {
+			prior1++
+		} else {
+			prior0++
+		}
+	}
+	hiTarget := (prior1 + 1) / (prior1 + 2)
+	loTarget := 1 / (prior0 + 2)
+	t := make([]float64, len(y))
+	for i, label := range y {
+		t[i] = loTarget
+		if label > 0 {
+			t[i] = hiTarget
+		}
+	}
+
+	const (
+		maxIter = 100
+		minStep = 1e-10
+		sigma   = 1e-12
+		eps     = 1e-5
+	)
+	A, B = 0, math.Log((prior0+1)/(prior1+1))
+	objective := func(A, B float64) (fval float64) {
+		for i := range f {
+			fApB := f[i]*A + B
+			if fApB >= 0 {
+				fval += t[i]*fApB + math.Log1p(math.Exp(-fApB))
+			} else {
+				fval += (t[i]-1)*fApB + math.Log1p(math.Exp(fApB))
+			}
+		}
+		return
+	}
+	fval := objective(A, B)
+
+	for iter := 0; iter < maxIter; iter++ {
+		h11, h22, h21, g1, g2 := sigma, sigma, 0.0, 0.0, 0.0
+		for i := range f {
+			fApB := f[i]*A + B
+			var p, q float64
+			if fApB >= 0 {
+				p = math.Exp(-fApB) / (1 + math.Exp(-fApB))
+				q = 1 / (1 + math.Exp(-fApB))
+			} else {
+				p = 1 / (1 + math.Exp(fApB))
+				q = math.Exp(fApB) / (1 + math.Exp(fApB))
+			}
+			d2 := p * q
+			h11 += f[i] * f[i] * d2
+			h22 += d2
+			h21 += f[i] * d2
+			d1 := t[i] - p
+			g1 += f[i] * d1
+			g2 += d1
+		}
+		if math.Abs(g1) < eps && math.Abs(g2) < eps {
+			break
+		}
+
+		det := h11*h22 - h21*h21
+		dA := -(h22*g1 - h21*g2) / det
+		dB := -(-h21*g1 + h11*g2) / det
+		gd := g1*dA + g2*dB
+
+		step := 1.0
+		for step >= minStep {
+			newA, newB := A+step*dA, B+step*dB
+			newf := objective(newA, newB)
+			if newf < fval+0.0001*step*gd {
+				A, B, fval = newA, newB, newf
+				break
+			}
+			step /= 2
+		}
+		if step < minStep {
+			break
+		}
+	}
+	return A, B
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLinear(t *testing.T) {
+	var examples []Example
+	for i := 0; i < 20; i++ {
+		examples = append(examples, toyExamples...)
+	}
+	for _, name := range LinearModels {
+		l, err := ConstructLinear(WithLoss(name), WithRegularization(1e-3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Train(examples)
+
+		for _, ex := range toyExamples {
+			scores := l.Score(ex.Document)
+			if got := argmax(scores); got != ex.Class {
+				t.Errorf("%v: Expected %v for %q. Got %v", name, ex.Class, ex.Document, got)
+			}
+			if sum := math.Exp(scores[Ham]) + math.Exp(scores[Spam]); math.Abs(sum-1) > 1e-9 {
+				t.Errorf("%v: Expected the probabilities to add up to 1. Got %v", name, sum)
+			}
+			if p := l.Prob(ex.Document); math.Abs(p-math.Exp(scores[Spam])) > 1e-9 {
+				t.Errorf("%v: Prob %v disagrees with Score %v", name, p, scores)
+			}
+		}
+
+		// a document of words never seen is left to the bias
+		if p := l.Prob([]string{"zzz"}); p < 0.2 || p > 0.8 {
+			t.Errorf("%v: Expected an uninformed probability for unseen words. Got %v", name, p)
+		}
+	}
+
+	if _, err := ConstructLinear(WithLoss("perceptron")); err == nil {
+		t.Error("Expected an error for an unknown linear model")
+	}
+}
+
+func TestHeldOutMargins(t *testing.T) {
+	// a word seen in a single example only weighs on the margins of the models trained on it
+	examples := []Example{{[]string{"solo"}, Spam}}
+	for i := 0; i < 20; i++ {
+		examples = append(examples, toyExamples...)
+	}
+	l, err := ConstructLinear(WithLoss("svm"), WithRegularization(1e-3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Train(examples)
+	xs := [][]feature{l.features(examples[0].Document, false)}
+	for _, ex := range examples[1:] {
+		xs = append(xs, l.features(ex.Document, false))
+	}
+	ys := make([]float64, len(examples))
+	for i, ex := range examples {
+		ys[i] = -1
+		if ex.Class == Spam {
+			ys[i] = 1
+		}
+	}
+	if held, trained := l.heldOutMargins(xs, ys)[0], l.margin(xs[0]); held >= trained {
+		t.Errorf("Expected a lower margin for %q held out than trained on. Got %v and %v", examples[0].Document, held, trained)
+	}
+}
+
+func TestPlattScaling(t *testing.T) {
+	f := []float64{-3, -2, -1.5, -1, -0.5, 0.5, 1, 1.5, 2, 3}
+	y := []float64{-1, -1, -1, -1, 1, -1, 1, 1, 1, 1}
+	A, B := plattScaling(f, y)
+	if A >= 0 {
+		t.Errorf("Expected larger margins to be more probably positive. Got A = %v", A)
+	}
+	if math.Abs(B) > 0.5 {
+		t.Errorf("Expected B close to 0 for symmetric margins. Got %v", B)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// mailDataset is raw mail: the paths of the ham and of the spam, each of which is anything
+// loadMail reads.
+type mailDataset struct {
+	Ham, Spam []string
+}
+
+func (ds mailDataset) Load(tok *Tokenizer) (examples []Example, err error) {
+	var errs errList
+	for _, src := range []struct {
+		paths []string
+		class Class
+	}{{ds.Ham, Ham}, {ds.Spam, Spam}} {
+		for _, path := range src.paths {
+			exs, err := loadMail(path, src.class, tok)
+			examples = append(examples, exs...)
+			if el, ok := err.(errList); ok {
+				errs = append(errs, el...)
+			} else if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if errs != nil {
+		return examples, errs
+	}
+	return examples, nil
+}
+
+// loadMail loads every message found at path as examples of the given class. path may be a
+// single message (.eml), an mbox archive, a Maildir, or a directory of messages.
+func loadMail(path string, class Class, tok *Tokenizer) ([]Example, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		if isMaildir(path) {
+			return loadMaildir(path, class, tok)
+		}
+		return loadMessageDir(path, class, tok)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if head, _ := r.Peek(5); string(head) == "From " {
+		return readMbox(r, path, class, tok)
+	}
+	ex, err := readEML(r, class, tok)
+	if err != nil {
+		return nil, errors.WithMessage(err, path)
+	}
+	return []Example{ex}, nil
+}
+
+// loadEML loads a single message.
+func loadEML(path string, class Class, tok *Tokenizer) (Example, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Example{}, err
+	}
+	defer f.Close()
+	ex, err := readEML(f, class, tok)
+	return ex, errors.WithMessage(err, path)
+}
+
+func readEML(r io.Reader, class Class, tok *Tokenizer) (Example, error) {
+	e, err := ParseEmail(r)
+	if err != nil {
+		return Example{}, err
+	}
+	return Example{e.Document(tok), class}, nil
+}
+
+// readMbox splits an mbox archive into messages. A line starting with "From " starts a new
+// message, and the ">From " quoting of mboxrd is undone. Messages that fail to parse are
+// reported in an errList, and do not stop the rest from being read.
+func readMbox(r io.Reader, path string, class Class, tok *Tokenizer) (examples []Example, err error) {
+	var errs errList
+	var msg bytes.Buffer
+	var n int
+	flush := func() {
+		if msg.Len() == 0 {
+			return
+		}
+		n++
+		ex, err := readEML(&msg, class, tok)
+		if err != nil {
+			errs = append(errs, errors.WithMessage(err, fmt.Sprintf("%v: message %d", path, n)))
+		} else {
+			examples = append(examples, ex)
+		}
+		msg.Reset()
+	}
+
+	br := bufio.NewReader(r)
+	var started bool
+	for {
+		line, rerr := br.ReadString('\n')
+		switch {
+		case strings.HasPrefix(line, "From "):
+			flush()
+			started = true
+		case !started:
+		case strings.HasPrefix(line, ">") && strings.HasPrefix(strings.TrimLeft(line, ">"), "From "):
+			msg.WriteString(line[1:])
+		default:
+			msg.WriteString(line)
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return examples, rerr
+		}
+	}
+	flush()
+
+	if errs != nil {
+		err = errs
+	}
+	return
+}
+
+// isMaildir reports whether dir has the cur, new and tmp subdirectories of a Maildir.
+func isMaildir(dir string) bool {
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// loadMaildir loads the delivered messages of a Maildir, that is, those in cur and new.
+func loadMaildir(dir string, class Class, tok *Tokenizer) (examples []Example, err error) {
+	var errs errList
+	for _, sub := range []string{"cur", "new"} {
+		exs, err := loadMessageDir(filepath.Join(dir, sub), class, tok)
+		examples = append(examples, exs...)
+		if el, ok := err.(errList); ok {
+			errs = append(errs, el...)
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		err = errs
+	}
+	return
+}
+
+// loadMessageDir loads every file in a directory as a single message. Hidden files are skipped.
+func loadMessageDir(dir string, class Class, tok *Tokenizer) (examples []Example, err error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var errs errList
+	for _, match := range matches {
+		if info, err := os.Stat(match); err != nil || info.IsDir() || strings.HasPrefix(filepath.Base(match), ".") {
+			continue
+		}
+		ex, err := loadEML(match, class, tok)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		examples = append(examples, ex)
+	}
+	if errs != nil {
+		err = errs
+	}
+	return
+}
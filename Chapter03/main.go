@@ -1,58 +1,684 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
 )
 
+var (
+	dataset    = flag.String("dataset", "lemm_stop", "Which variant of the lingspam corpus to use. Valid options are \"bare\", \"lemm\", \"lemm_stop\" or \"stop\"")
+	corpusKind = flag.String("corpus", "lingspam", "Which corpus to use. Valid options are \"lingspam\", \"spamassassin\", \"enron\" or \"csv\"")
+	corpusPath = flag.String("data", "", "Directory of the -corpus, or the file of a csv corpus. Defaults to data/lingspam_public for lingspam")
+	workers    = flag.Int("workers", runtime.NumCPU(), "Number of files of the -corpus read at once")
+	loadModel  = flag.String("load", "", "Load a trained model from this file instead of training a new one")
+	saveModel  = flag.String("save", "", "Save the trained model to this file")
+	model      = flag.String("model", "tfidf", "Which model to use. Valid options are the Naive Bayes models \"tfidf\", \"multinomial\", \"bernoulli\" or \"complement\", and, with -compare or -cv, the linear models \"logistic\" or \"svm\"")
+	smoothing  = flag.Float64("smoothing", 1, "Additive smoothing parameter for the multinomial, Bernoulli and complement models")
+	compare    = flag.Bool("compare", false, "Compare all the models on the held out lingspam parts")
+	cv         = flag.Bool("cv", false, "Cross validate the model on each variant of lingspam, using its parts as folds, or on -ham and -spam using stratified random folds")
+	folds      = flag.Int("folds", 10, "Number of stratified random folds to cross validate -ham and -spam with")
+	seed       = flag.Int64("seed", 1337, "Random seed for the stratified folds, and for the split of the examples a new model is trained on")
+
+	reportFile = flag.String("report", "", "Write the evaluation report as JSON to this file")
+
+	hamMail      = flag.String("ham", "", "Comma separated list of .eml files, mbox archives or Maildirs of ham to use instead of lingspam")
+	spamMail     = flag.String("spam", "", "Comma separated list of .eml files, mbox archives or Maildirs of spam to use instead of lingspam")
+	classifyFile = flag.String("classify", "", "Classify a raw email with the model given by -load")
+	explainFile  = flag.String("explain", "", "Explain the classification of a raw email by the model given by -load")
+	explainTop   = flag.Int("top", 10, "Number of tokens -explain lists for each class")
+
+	feedbackLog  = flag.String("feedback", "feedback.jsonl", "Audit log of the corrections made with -mark and -feedbackhttp")
+	mark         = flag.String("mark", "", "Mark the raw emails given as arguments as \"spam\" or \"ham\", and correct the model given by -load with them")
+	feedbackAddr = flag.String("feedbackhttp", "", "Take corrections to the model given by -load over HTTP on this address")
+	replay       = flag.Bool("replay", false, "Rebuild the model from scratch: train it on the corpus, then replay the corrections of the -feedback log")
+
+	smtpAddr   = flag.String("smtp", "", "Run an SMTP server on this address that tags mail with the model given by -load")
+	upstream   = flag.String("upstream", "", "Address of the SMTP server the -smtp server forwards tagged mail to")
+	deliverDir = flag.String("maildir", "", "Maildir the -smtp server delivers tagged mail to, instead of forwarding it")
+
+	normalize  = flag.Bool("normalize", true, "Unicode normalize the text and remove diacritics")
+	lowercase  = flag.Bool("lower", true, "Lowercase the text")
+	stripPunct = flag.Bool("punct", true, "Split words on punctuation and remove it")
+	numbers    = flag.String("numbers", "collapse", "What to do with numbers. Valid options are \"keep\", \"drop\" or \"collapse\"")
+	stopword   = flag.Bool("stopwords", false, "Remove stopwords")
+	stem       = flag.Bool("stem", false, "Stem words with the Snowball English stemmer")
+	ngramLen   = flag.Int("ngrams", 1, "Add word n-grams up to this length")
+	fold       = flag.Bool("fold", false, "Fold homoglyphs and leetspeak into plain letters")
+	charNGram  = flag.Int("charngrams", 0, "Add character n-grams of this length")
+	patterns   = flag.Bool("patterns", false, "Add counts of URLs, runs of capitals and currency symbols")
+
+	tune   = flag.Bool("tune", false, "Tune the decision threshold of the model given by -load on the examples held out from its training, and save it with -save")
+	maxFPR = flag.Float64("fpr", 0, "Tune the threshold for at most this false positive rate instead of the lowest cost")
+	fpCost = flag.Float64("fpcost", 10, "Cost of flagging ham as spam when tuning the threshold")
+	fnCost = flag.Float64("fncost", 1, "Cost of letting spam through when tuning the threshold")
+
+	lambda = flag.Float64("lambda", 1e-4, "L2 regularization strength of the linear models")
+	epochs = flag.Int("epochs", 5, "Number of passes over the training examples of the linear models")
+
+	minDF     = flag.Int("mindf", 1, "Prune the words that appear in fewer documents than this")
+	maxDF     = flag.Float64("maxdf", 1, "Prune the words that appear in more than this fraction of the documents")
+	selection = flag.String("select", "", "Keep only the -topk words that score highest by \"chi2\" (chi-square) or \"ig\" (information gain)")
+	topK      = flag.String("topk", "1000", "Number of words -select keeps. A comma separated list compares the accuracy of each on the held out lingspam parts")
+
+	buckets = flag.Int("buckets", 0, "Hash words into this many buckets instead of keeping a vocabulary. 0 keeps a vocabulary")
+)
+
+// tokenizerConfig builds the tokenizer configuration from the command line flags.
+func tokenizerConfig() TokenizerConfig {
+	nm, err := parseNumberMode(*numbers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return TokenizerConfig{
+		Normalize:  *normalize,
+		Lowercase:  *lowercase,
+		StripPunct: *stripPunct,
+		Numbers:    nm,
+		Stopwords:  *stopword,
+		Stem:       *stem,
+		NGrams:     *ngramLen,
+		Fold:       *fold,
+		CharNGrams: *charNGram,
+		Patterns:   *patterns,
+	}
+}
+
+// consOpts are the construction options of a classifier as configured by the flags.
+func consOpts(modelName string) []ConsOpt {
+	opts := []ConsOpt{WithModel(modelName), WithSmoothing(*smoothing), WithTokenizer(tokenizerConfig())}
+	if *buckets > 0 {
+		opts = append(opts, WithHashing(*buckets, false))
+	}
+	return opts
+}
+
+// newTrainer creates an untrained Naive Bayes or linear model as configured by the flags.
+func newTrainer(modelName string) (trainer, error) {
+	for _, name := range LinearModels {
+		if name == modelName {
+			return ConstructLinear(WithLoss(name), WithRegularization(*lambda), WithEpochs(*epochs), WithSeed(*seed), WithLinearTokenizer(tokenizerConfig()))
+		}
+	}
+	c, err := Construct(consOpts(modelName)...)
+	if err != nil {
+		return nil, err
+	}
+	return pruning{c, topKs()[0]}, nil
+}
+
+// pruning is a classifier whose vocabulary is pruned as configured by the flags after training.
+type pruning struct {
+	*Classifier
+	k int
+}
+
+func (p pruning) Train(examples []Example) {
+	p.Classifier.Train(examples)
+	pruneVocabulary(p.Classifier, p.k)
+}
+
+// featureScorer returns the feature selection given by -select, or nil if there is none.
+func featureScorer() FeatureScorer {
+	switch *selection {
+	case "":
+		return nil
+	case "chi2":
+		return ChiSquare
+	case "ig":
+		return InformationGain
+	}
+	log.Fatalf("Unknown feature selection %q. Expected \"chi2\" or \"ig\"", *selection)
+	return nil
+}
+
+// topKs parses -topk.
+func topKs() (ks []int) {
+	for _, s := range strings.Split(*topK, ",") {
+		k, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || k <= 0 {
+			log.Fatalf("-topk expects positive numbers. Got %q", s)
+		}
+		ks = append(ks, k)
+	}
+	return
+}
+
+// pruneVocabulary prunes the vocabulary of a trained classifier by document frequency, and then
+// keeps its k best words if -select is set.
+func pruneVocabulary(c *Classifier, k int) {
+	if *minDF > 1 || *maxDF < 1 {
+		c.PruneDF(*minDF, *maxDF)
+	}
+	if score := featureScorer(); score != nil {
+		c.SelectFeatures(k, score)
+	}
+}
+
+// classifier loads the classifier given by -load, or creates an untrained one as configured by the flags.
+func classifier(modelName string) *Classifier {
+	if *loadModel != "" {
+		c, err := LoadFile(*loadModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Model loaded from %v\n", *loadModel)
+		return c
+	}
+	c, err := Construct(consOpts(modelName)...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return c
+}
+
 func main() {
-	typ := "lemm_stop"
-	examples, err := ingest(typ)
+	flag.Parse()
+	typ := *dataset
+	if *replay && *loadModel != "" {
+		log.Fatal("-replay rebuilds the model from scratch, and cannot be used with -load")
+	}
+	if *compare {
+		compareModels(typ)
+		return
+	}
+	if *selection != "" && len(topKs()) > 1 {
+		compareSelections(typ)
+		return
+	}
+	if *cv {
+		crossValidation()
+		return
+	}
+	if *classifyFile != "" {
+		classifyEmail(*classifyFile)
+		return
+	}
+	if *tune {
+		tuneThreshold(typ)
+		return
+	}
+	if *explainFile != "" {
+		explainEmail(*explainFile)
+		return
+	}
+	if *mark != "" {
+		markEmails(flag.Args())
+		return
+	}
+	if *smtpAddr != "" {
+		serveSMTP()
+		return
+	}
+	if *feedbackAddr != "" {
+		fs := openFeedback(classifier(*model))
+		log.Fatal(serveFeedback(fs))
+	}
+
+	c := classifier(*model)
+	ds, err := examplesDataset(typ)
 	if err != nil {
 		log.Fatal(err)
 	}
+	// documents are tokenized the same way the classifier was trained with. The order is seeded,
+	// so that -replay rebuilds the model the corrections were made against, and -tune tunes the
+	// saved model on the examples it was not trained on
+	ch, wait := Ingester{Workers: *workers, Seed: *seed}.Stream(ds, NewTokenizer(c.Tokenizer))
+	var examples, cv []Example
+	if *loadModel != "" {
+		// the loaded model was trained on a different split, so everything is held out.
+		for ex := range ch {
+			cv = append(cv, ex)
+		}
+	} else {
+		// the examples are trained on as they are read
+		c.Seed = *seed
+		train := make(chan Example)
+		trained := make(chan int)
+		go func() { trained <- c.TrainStream(train) }()
+		var i int
+		for ex := range ch {
+			if heldOut(i) {
+				cv = append(cv, ex)
+			} else {
+				examples = append(examples, ex)
+				train <- ex
+			}
+			i++
+		}
+		close(train)
+		<-trained
+	}
+	if err := skipUnreadable(wait()); err != nil {
+		log.Fatal(err)
+	}
+	typ = datasetName(typ)
+	fmt.Printf("Examples loaded: %d\n", len(examples)+len(cv))
 
-	fmt.Printf("Examples loaded: %d\n", len(examples))
-	shuffle(examples)
-	cvStart := len(examples) - len(examples)/3
-	cv := examples[cvStart:]
-	examples = examples[:cvStart]
+	if *loadModel == "" {
+		pruneVocabulary(c, topKs()[0])
+		if *replay {
+			n, err := ReplayFeedbackFile(*feedbackLog, c)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Corrections replayed from %v: %d\n", *feedbackLog, n)
+		}
 
-	c := New()
-	c.Train(examples)
+		var corrects, totals float64
+		for _, ex := range examples {
+			// fmt.Printf("%v", c.Score(ham.Document))
+			class := c.Predict(ex.Document)
+			if class == ex.Class {
+				corrects++
+			}
+			totals++
+		}
+		fmt.Printf("Dataset: %q. Corrects: %v, Totals: %v. Accuracy %v\n", typ, corrects, totals, corrects/totals)
+	}
 
-	var corrects, totals float64
-	for _, ex := range examples {
-		// fmt.Printf("%v", c.Score(ham.Document))
-		class := c.Predict(ex.Document)
-		if class == ex.Class {
-			corrects++
+	if *saveModel != "" {
+		if err := c.SaveFile(*saveModel); err != nil {
+			log.Fatal(err)
 		}
-		totals++
+		fmt.Printf("Model saved to %v\n", *saveModel)
 	}
-	fmt.Printf("Dataset: %q. Corrects: %v, Totals: %v. Accuracy %v\n", typ, corrects, totals, corrects/totals)
 
 	fmt.Println("Start Cross Validation (this classifier)")
-	corrects, totals = 0, 0
-	hams, spams := 0.0, 0.0
 	var unseen, totalWords int
 	for _, ex := range cv {
 		totalWords += len(ex.Document)
 		unseen += c.unseens(ex.Document)
-		class := c.Predict(ex.Document)
-		if class == ex.Class {
-			corrects++
+	}
+	report := evaluate(fmt.Sprintf("%s/%s", typ, c.Model), c, cv)
+	fmt.Print(report)
+	fmt.Printf("Previously unseen %d. Total Words %d\n", unseen, totalWords)
+	writeReports(report)
+}
+
+// heldOut reports whether a new model is not trained on the i-th example loaded: every third
+// example is held out.
+func heldOut(i int) bool { return i%3 == 2 }
+
+// holdOut splits the examples into those a new model is trained on and those held out.
+func holdOut(examples []Example) (train, test []Example) {
+	for i, ex := range examples {
+		if heldOut(i) {
+			test = append(test, ex)
+		} else {
+			train = append(train, ex)
 		}
-		switch ex.Class {
-		case Ham:
-			hams++
-		case Spam:
-			spams++
+	}
+	return train, test
+}
+
+// skipUnreadable logs the messages in an errList, which could not be read and are left out, and
+// returns any other error.
+func skipUnreadable(err error) error {
+	el, ok := err.(errList)
+	if !ok {
+		return err
+	}
+	for _, e := range el {
+		log.Printf("Skipping a message that cannot be read: %v", e)
+	}
+	return nil
+}
+
+// lingspamOnly reports whether the examples come from lingspam, which has its own folds.
+func lingspamOnly() bool {
+	return *hamMail == "" && *spamMail == "" && (*corpusKind == "lingspam" || *corpusKind == "")
+}
+
+// datasetName names the examples loadExamples loads in reports.
+func datasetName(typ string) string {
+	switch {
+	case *hamMail != "" || *spamMail != "":
+		return "mail"
+	case !lingspamOnly():
+		return *corpusKind
+	}
+	return typ
+}
+
+// examplesDataset is the raw mail given by -ham and -spam if there is any, or the -corpus otherwise.
+func examplesDataset(typ string) (Dataset, error) {
+	if *hamMail == "" && *spamMail == "" {
+		return openDataset(*corpusKind, *corpusPath, typ)
+	}
+	var ds mailDataset
+	if *hamMail != "" {
+		ds.Ham = strings.Split(*hamMail, ",")
+	}
+	if *spamMail != "" {
+		ds.Spam = strings.Split(*spamMail, ",")
+	}
+	return ds, nil
+}
+
+// loadExamples loads the examples of examplesDataset, in an order shuffled by seed if it is not 0.
+func loadExamples(typ string, tok *Tokenizer, seed int64) ([]Example, error) {
+	ds, err := examplesDataset(typ)
+	if err != nil {
+		return nil, err
+	}
+	return Ingester{Workers: *workers, Seed: seed}.Load(ds, tok)
+}
+
+// classifyEmail prints the class of a raw email.
+func classifyEmail(filename string) {
+	if *loadModel == "" {
+		log.Fatal("-classify needs a trained model. Use -load")
+	}
+	c := classifier(*model)
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	e, err := ParseEmail(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	doc := e.Document(NewTokenizer(c.Tokenizer))
+	p := c.SpamProb(doc)
+	fmt.Printf("%v: %v (From: %v, Subject: %q, Links: %d, P(Spam): %.4f, Threshold: %.4f)\n", filename, c.Predict(doc), e.From, e.Subject, e.Links, p, c.Threshold)
+}
+
+// tuneThreshold tunes the decision threshold of a trained model on held out examples, either
+// for a maximum false positive rate or for the lowest cost.
+func tuneThreshold(typ string) {
+	if *loadModel == "" {
+		log.Fatal("-tune needs a trained model. Use -load")
+	}
+	c := classifier(*model)
+	examples, err := loadExamples(typ, NewTokenizer(c.Tokenizer), c.Seed)
+	if err = skipUnreadable(err); err != nil {
+		log.Fatal(err)
+	}
+	// only the examples held out from the training of the model are tuned on
+	_, examples = holdOut(examples)
+	fmt.Printf("Held out examples tuned on: %d\n", len(examples))
+	before := evaluate("before", c, examples)
+
+	choose := MinCost(CostMatrix{Ham: {Spam: *fpCost}, Spam: {Ham: *fnCost}})
+	if *maxFPR > 0 {
+		choose = MaxFPR(*maxFPR)
+	}
+	if err := c.Tune(examples, choose); err != nil {
+		log.Fatal(err)
+	}
+	after := evaluate("after", c, examples)
+	fmt.Printf("Calibration: A %.4f, B %.4f. Threshold: %.4f\n", c.Calibration.A, c.Calibration.B, c.Threshold)
+	for _, r := range []Report{before, after} {
+		fp, fn := r.Confusion[Ham][Spam], r.Confusion[Spam][Ham]
+		fmt.Printf("%-6s\tFalse positives %d\tFalse negatives %d\tFPR %.4f\tCost %.1f\n", r.Name, fp, fn, r.FalsePositiveRate, float64(fp)**fpCost+float64(fn)**fnCost)
+	}
+
+	if *saveModel != "" {
+		if err := c.SaveFile(*saveModel); err != nil {
+			log.Fatal(err)
 		}
-		totals++
+		fmt.Printf("Model saved to %v\n", *saveModel)
 	}
+}
 
-	fmt.Printf("Dataset: %q. Corrects: %v, Totals: %v. Accuracy %v\n", typ, corrects, totals, corrects/totals)
-	fmt.Printf("Hams: %v, Spams: %v. Ratio to beat: %v\n", hams, spams, hams/(hams+spams))
-	fmt.Printf("Previously unseen %d. Total Words %d\n", unseen, totalWords)
+// explainEmail prints a raw email with the words that weigh most on its classification marked,
+// followed by the breakdown of its scores.
+func explainEmail(filename string) {
+	if *loadModel == "" {
+		log.Fatal("-explain needs a trained model. Use -load")
+	}
+	c := classifier(*model)
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	e, err := ParseEmail(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tok := NewTokenizer(c.Tokenizer)
+	ex := c.Explain(e.Document(tok), *explainTop)
+	fmt.Printf("From: %v\nSubject: %v\n\n", e.From, ex.Annotate(e.Subject, tok))
+	fmt.Printf("%v\n\n", ex.Annotate(e.Text, tok))
+	fmt.Printf("{+word+} pushes towards %v, [-word-] towards %v\n%v", Spam, Ham, ex)
+}
+
+// openFeedback opens the -feedback log for corrections to a loaded model. The corrected model is
+// saved to -save, or back to -load.
+func openFeedback(c *Classifier) *FeedbackStore {
+	if *loadModel == "" {
+		log.Fatal("Corrections need a trained model. Use -load")
+	}
+	fs, err := OpenFeedback(c, *feedbackLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fs.SaveTo = *saveModel
+	if fs.SaveTo == "" {
+		fs.SaveTo = *loadModel
+	}
+	return fs
+}
+
+// markEmails corrects the model with the raw emails given, marked as -mark.
+func markEmails(filenames []string) {
+	class, ok := parseLabel(*mark)
+	if !ok {
+		log.Fatalf("-mark expects \"spam\" or \"ham\". Got %q", *mark)
+	}
+	if len(filenames) == 0 {
+		log.Fatal("-mark needs the emails to mark as arguments")
+	}
+	fs := openFeedback(classifier(*model))
+	defer fs.Close()
+	for _, filename := range filenames {
+		msg, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		corr, err := fs.Correct(msg, class, os.Getenv("USER"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%v: marked as %v (was %v)\n", filename, corr.Class, corr.Previous)
+	}
+	fmt.Printf("Model saved to %v\n", fs.SaveTo)
+}
+
+// serveFeedback takes corrections over HTTP at /feedback.
+func serveFeedback(fs *FeedbackStore) error {
+	mux := http.NewServeMux()
+	mux.Handle("/feedback", fs)
+	log.Printf("Taking corrections over HTTP on %v/feedback", *feedbackAddr)
+	return http.ListenAndServe(*feedbackAddr, mux)
+}
+
+// crossValidation cross validates the model configured by the flags, and prints the metrics
+// of every fold and their averages.
+func crossValidation() {
+	tok := NewTokenizer(tokenizerConfig())
+	fresh := func() trainer {
+		c, err := newTrainer(*model)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return c
+	}
+
+	var averages []Report
+	run := func(name string, folds [][]Example) {
+		reports, err := crossValidate(name, folds, fresh)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, r := range reports {
+			fmt.Println(r.summary())
+		}
+		avg := averageReports(name+" mean", reports)
+		fmt.Println(avg.summary())
+		averages = append(averages, avg)
+	}
+
+	if !lingspamOnly() {
+		examples, err := loadExamples(*dataset, tok, 0)
+		if err = skipUnreadable(err); err != nil {
+			log.Fatal(err)
+		}
+		stratified, err := stratifiedFolds(examples, *folds, rand.New(rand.NewSource(*seed)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		run(datasetName("")+"/"+*model, stratified)
+	} else {
+		for _, typ := range lingspamVariants {
+			folds, err := ingestFolds(typ, tok)
+			if err = skipUnreadable(err); err != nil {
+				log.Fatal(err)
+			}
+			run(typ+"/"+*model, folds)
+		}
+	}
+
+	fmt.Println()
+	for _, avg := range averages {
+		fmt.Println(avg.summary())
+	}
+	if *reportFile != "" {
+		if err := writeJSON(*reportFile, averages...); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// serveSMTP runs the SMTP filtering proxy.
+func serveSMTP() {
+	if *loadModel == "" {
+		log.Fatal("-smtp needs a trained model. Use -load")
+	}
+	c := classifier(*model)
+
+	var next deliverer
+	switch {
+	case *upstream != "" && *deliverDir != "":
+		log.Fatal("Use only one of -upstream and -maildir")
+	case *upstream != "":
+		next = relay(*upstream)
+	case *deliverDir != "":
+		next = maildir(*deliverDir)
+	default:
+		log.Fatal("-smtp needs either -upstream or -maildir")
+	}
+
+	if *feedbackAddr != "" {
+		fs := openFeedback(c)
+		go func() { log.Fatal(serveFeedback(fs)) }()
+	}
+
+	s := newSMTPServer(spamFilter{c, next})
+	log.Printf("Listening for SMTP on %v", *smtpAddr)
+	if err := s.ListenAndServe(*smtpAddr); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeReports writes the ROC and precision-recall curves of the reports, and the reports
+// themselves if a report file was asked for.
+func writeReports(reports ...Report) {
+	if err := plotCurves("roc.png", "pr.png", reports...); err != nil {
+		log.Fatal(err)
+	}
+	if *reportFile != "" {
+		if err := writeJSON(*reportFile, reports...); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// compareModels trains each Naive Bayes and linear model on lingspam parts 1-7 and tests it on
+// parts 8-10, or on two thirds of any other corpus, tested on the rest.
+func compareModels(typ string) {
+	train, test := trainTestSplit(typ, NewTokenizer(tokenizerConfig()))
+
+	var reports []Report
+	for _, name := range append(Models, LinearModels...) {
+		c, err := newTrainer(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.Train(train)
+
+		report := evaluate(name, c, test)
+		fmt.Print(report)
+		reports = append(reports, report)
+	}
+
+	fmt.Printf("\n%-12s\t%-8s\t%-8s\t%-8s\t%-8s\t%-8s\n", "Model", "Accuracy", "FPR", "Spam F1", "ROC AUC", "PR AUC")
+	for _, r := range reports {
+		fmt.Printf("%-12s\t%-8.4f\t%-8.4f\t%-8.4f\t%-8.4f\t%-8.4f\n", r.Name, r.Accuracy, r.FalsePositiveRate, r.Classes[Spam].F1, r.ROCAUC, r.PRAUC)
+	}
+	writeReports(reports...)
+}
+
+// trainTestSplit splits lingspam into parts 1-7 for training and parts 8-10 for testing. Other
+// corpora are split into thirds, two of which are for training.
+func trainTestSplit(typ string, tok *Tokenizer) (train, test []Example) {
+	if lingspamOnly() {
+		var err error
+		if train, err = ingestParts(typ, tok, 0, 8); skipUnreadable(err) != nil {
+			log.Fatal(err)
+		}
+		if test, err = ingestParts(typ, tok, 8, 11); skipUnreadable(err) != nil {
+			log.Fatal(err)
+		}
+	} else {
+		examples, err := loadExamples(typ, tok, 0)
+		if err = skipUnreadable(err); err != nil {
+			log.Fatal(err)
+		}
+		thirds, err := stratifiedFolds(examples, 3, rand.New(rand.NewSource(*seed)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		train, test = append(thirds[0], thirds[1]...), thirds[2]
+	}
+	fmt.Printf("Dataset: %q. Training examples: %d, Test examples: %d\n", datasetName(typ), len(train), len(test))
+	return
+}
+
+// compareSelections reports how the accuracy of the model changes with the number of words
+// feature selection keeps.
+func compareSelections(typ string) {
+	train, test := trainTestSplit(typ, NewTokenizer(tokenizerConfig()))
+
+	fmt.Printf("\n%-8s\t%-8s\t%-8s\t%-8s\t%-8s\t%-8s\n", "K", "Words", "Accuracy", "FPR", "Spam F1", "ROC AUC")
+	var reports []Report
+	for _, k := range append([]int{0}, topKs()...) {
+		c, err := Construct(consOpts(*model)...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.Train(train)
+		name := "all"
+		if k > 0 {
+			pruneVocabulary(c, k)
+			name = strconv.Itoa(k)
+		}
+
+		r := evaluate(fmt.Sprintf("%s/%s", *selection, name), c, test)
+		fmt.Printf("%-8s\t%-8d\t%-8.4f\t%-8.4f\t%-8.4f\t%-8.4f\n", name, len(c.docFreqs()), r.Accuracy, r.FalsePositiveRate, r.Classes[Spam].F1, r.ROCAUC)
+		reports = append(reports, r)
+	}
+	writeReports(reports...)
 }
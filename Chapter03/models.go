@@ -0,0 +1,175 @@
+package main
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Model is a Naive Bayes event model. It turns the statistics collected by a Classifier into
+// the likelihood of a document given a class.
+//
+// The methods are called with the classifier locked. Word IDs that have never been seen in
+// training are passed in as -1.
+type Model interface {
+	// Name is the name the model goes by on the command line and in saved models.
+	Name() string
+
+	// prepare is called whenever the classifier's statistics have changed.
+	prepare(c *Classifier)
+
+	// logProb is the contribution of one occurrence of a word to the log likelihood of a class.
+	logProb(c *Classifier, id int, class Class) float64
+
+	// logLikelihood is the log likelihood of a document given a class.
+	logLikelihood(c *Classifier, doc []int, class Class) float64
+}
+
+// Models lists the names of all the available models.
+var Models = []string{"tfidf", "multinomial", "bernoulli", "complement"}
+
+// modelByName returns a fresh instance of the named model.
+func modelByName(name string) (Model, error) {
+	switch name {
+	case "tfidf", "":
+		return tfidfModel{}, nil
+	case "multinomial":
+		return multinomial{}, nil
+	case "bernoulli":
+		return &bernoulli{}, nil
+	case "complement":
+		return complement{}, nil
+	}
+	return nil, errors.Errorf("Unknown model %q. Expected one of %v", name, Models)
+}
+
+// tfidfModel is the original scoring of this chapter: each word is weighted by its
+// document frequency in a class times its IDF. Words that are not found in a class get
+// the probability c.Tiny. The scores are not normalized likelihoods.
+type tfidfModel struct{}
+
+func (tfidfModel) Name() string          { return "tfidf" }
+func (tfidfModel) prepare(c *Classifier) {}
+
+func (tfidfModel) logProb(c *Classifier, id int, class Class) float64 {
+	return math.Log(c.prob(id, class))
+}
+
+func (m tfidfModel) logLikelihood(c *Classifier, doc []int, class Class) (retVal float64) {
+	for _, id := range doc {
+		retVal += m.logProb(c, id, class)
+	}
+	return
+}
+
+// multinomial is the multinomial Naive Bayes model with additive smoothing:
+//
+//	P(w|c) = (count(w, c) + α) / (count(c) + α|V|)
+//
+// α = 1 is Laplace smoothing; 0 < α < 1 is Lidstone smoothing.
+// Words outside the vocabulary are ignored.
+type multinomial struct{}
+
+func (multinomial) Name() string          { return "multinomial" }
+func (multinomial) prepare(c *Classifier) {}
+
+func (multinomial) logProb(c *Classifier, id int, class Class) float64 {
+	if id < 0 {
+		return 0
+	}
+	a := c.Smoothing
+	return math.Log((c.counts[class][id] + a) / (c.tokens[class] + a*float64(c.vocabSize())))
+}
+
+func (m multinomial) logLikelihood(c *Classifier, doc []int, class Class) (retVal float64) {
+	for _, id := range doc {
+		retVal += m.logProb(c, id, class)
+	}
+	return
+}
+
+// bernoulli is the Bernoulli Naive Bayes model. A document is the set of words it contains,
+// and every word in the vocabulary that is absent from the document counts against a class too.
+//
+//	P(w|c) = (docs(w, c) + α) / (docs(c) + 2α)
+type bernoulli struct {
+	absent [MAXCLASS]float64 // Σ log(1 - P(w|c)) over the vocabulary
+}
+
+func (*bernoulli) Name() string { return "bernoulli" }
+
+func (m *bernoulli) p(c *Classifier, id int, class Class) float64 {
+	var df float64
+	if id >= 0 {
+		df = c.tfidfs[class].TF[id]
+	}
+	a := c.Smoothing
+	return (df + a) / (c.totals[class] + 2*a)
+}
+
+func (m *bernoulli) prepare(c *Classifier) {
+	for i := range m.absent {
+		class := Class(i)
+		p0 := m.p(c, -1, class)
+		absent := float64(c.vocabSize()) * math.Log1p(-p0)
+		for id := range c.tfidfs[class].TF {
+			absent += math.Log1p(-m.p(c, id, class)) - math.Log1p(-p0)
+		}
+		m.absent[i] = absent
+	}
+}
+
+// logProb is the change in log likelihood when the word is present rather than absent.
+func (m *bernoulli) logProb(c *Classifier, id int, class Class) float64 {
+	if id < 0 {
+		return 0
+	}
+	p := m.p(c, id, class)
+	return math.Log(p) - math.Log1p(-p)
+}
+
+func (m *bernoulli) logLikelihood(c *Classifier, doc []int, class Class) float64 {
+	retVal := m.absent[class]
+	seen := make(map[int]struct{}, len(doc))
+	for _, id := range doc {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		retVal += m.logProb(c, id, class)
+	}
+	return retVal
+}
+
+// complement is Complement Naive Bayes (Rennie et al. 2003). The word distribution of a class
+// is estimated from every other class, and a document scores highly for a class when it is
+// unlikely under the complement:
+//
+//	P(w|¬c) = (count(w, ¬c) + α) / (count(¬c) + α|V|)
+type complement struct{}
+
+func (complement) Name() string          { return "complement" }
+func (complement) prepare(c *Classifier) {}
+
+func (complement) logProb(c *Classifier, id int, class Class) float64 {
+	if id < 0 {
+		return 0
+	}
+	var count, total float64
+	for i := Ham; i < MAXCLASS; i++ {
+		if i == class {
+			continue
+		}
+		count += c.counts[i][id]
+		total += c.tokens[i]
+	}
+	a := c.Smoothing
+	return -math.Log((count + a) / (total + a*float64(c.vocabSize())))
+}
+
+func (m complement) logLikelihood(c *Classifier, doc []int, class Class) (retVal float64) {
+	for _, id := range doc {
+		retVal += m.logProb(c, id, class)
+	}
+	return
+}
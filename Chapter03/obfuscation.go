@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// homoglyphs maps letters that look like Latin letters to the letters they look like. NFKC
+// already folds the fullwidth and mathematical forms, so these are mostly Cyrillic and Greek.
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c',
+	'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i', 'ј': 'j', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P', 'С': 'C',
+	'Т': 'T', 'У': 'Y', 'Х': 'X', 'Ѕ': 'S', 'І': 'I', 'Ј': 'J',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't',
+	'υ': 'u', 'χ': 'x', 'γ': 'y',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N',
+	'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	// Latin look-alikes
+	'ı': 'i', 'ɡ': 'g', 'ℓ': 'l',
+}
+
+// leet maps the digits and symbols that stand in for letters in leetspeak.
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's', '!': 'i', '|': 'l',
+}
+
+// foldHomoglyphs returns a transformer that normalizes the text and replaces homoglyphs by the
+// Latin letters they look like. Transformers are stateful, so a new one is needed for every text.
+func foldHomoglyphs() transform.Transformer {
+	return transform.Chain(norm.NFKC, runes.Map(func(r rune) rune {
+		if l, ok := homoglyphs[r]; ok {
+			return l
+		}
+		return r
+	}))
+}
+
+// foldLeet replaces leetspeak in the words of the text: digits and symbols between the first
+// and last letter of a word are replaced by the letters they stand in for, so "V1agra" becomes
+// "Viagra", but "2018" and "win!" are left alone.
+func foldLeet(text string) string {
+	fields := strings.Fields(text)
+	for i, field := range fields {
+		rs := []rune(field)
+		first, last := -1, -1
+		for j, r := range rs {
+			if unicode.IsLetter(r) {
+				if first < 0 {
+					first = j
+				}
+				last = j
+			}
+		}
+		for j := first + 1; j < last; j++ {
+			if l, ok := leet[rs[j]]; ok {
+				rs[j] = l
+			}
+		}
+		fields[i] = string(rs)
+	}
+	return strings.Join(fields, " ")
+}
+
+// charNGrams returns the character n-grams of length n of the words, with the start and end of
+// each word marked by < and >. They are prefixed with "c:" to keep them apart from the words.
+func charNGrams(words []string, n int) (retVal []string) {
+	for _, word := range words {
+		if word == numberToken {
+			continue
+		}
+		rs := []rune("<" + word + ">")
+		for i := 0; i+n <= len(rs); i++ {
+			retVal = append(retVal, "c:"+string(rs[i:i+n]))
+		}
+	}
+	return
+}
+
+// suspiciousPatterns counts the patterns of the raw text that are typical of spam: URLs, runs of
+// words in capitals, and currency symbols. Each count is a token, bucketed like linksFeature.
+func suspiciousPatterns(text string) []string {
+	urls := len(urlRe.FindAllStringIndex(text, -1))
+
+	var capsRuns, currency int
+	var inRun bool
+	for _, field := range strings.Fields(text) {
+		var letters, upper int
+		for _, r := range field {
+			if unicode.Is(unicode.Sc, r) {
+				currency++
+			}
+			if unicode.IsLetter(r) {
+				letters++
+				if unicode.IsUpper(r) {
+					upper++
+				}
+			}
+		}
+		caps := letters >= 2 && upper == letters
+		if caps && !inRun {
+			capsRuns++
+		}
+		inRun = caps
+	}
+	return []string{countFeature("urls", urls), countFeature("caps", capsRuns), countFeature("currency", currency)}
+}
+
+// countFeature buckets a count into a token: name:0, name:1, name:2-4, name:5-9 or name:10+.
+func countFeature(name string, n int) string {
+	switch {
+	case n < 2:
+		return fmt.Sprintf("%s:%d", name, n)
+	case n < 5:
+		return name + ":2-4"
+	case n < 10:
+		return name + ":5-9"
+	}
+	return name + ":10+"
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/chewxy/lingo/corpus"
+)
+
+// FeatureScorer scores how well a word discriminates between the classes, given the number of
+// documents of each class it appears in (df) and the number of documents of each class (totals).
+type FeatureScorer func(df, totals [MAXCLASS]float64) float64
+
+// ChiSquare is the χ² statistic of the independence of the word and the class, maximized over
+// the classes.
+func ChiSquare(df, totals [MAXCLASS]float64) (retVal float64) {
+	var n, withWord float64
+	for i := range totals {
+		n += totals[i]
+		withWord += df[i]
+	}
+	for i := range totals {
+		// the contingency table of the word against class i
+		a := df[i]                        // in class, with word
+		b := withWord - df[i]             // not in class, with word
+		c := totals[i] - df[i]            // in class, without word
+		d := n - totals[i] - withWord + a // not in class, without word
+		denom := (a + c) * (b + d) * (a + b) * (c + d)
+		if denom == 0 {
+			continue
+		}
+		retVal = math.Max(retVal, n*(a*d-c*b)*(a*d-c*b)/denom)
+	}
+	return
+}
+
+// InformationGain is the reduction in the entropy of the class from knowing whether the word
+// is in the document.
+func InformationGain(df, totals [MAXCLASS]float64) float64 {
+	var n, withWord float64
+	var with, without [MAXCLASS]float64
+	for i := range totals {
+		n += totals[i]
+		withWord += df[i]
+		with[i] = df[i]
+		without[i] = totals[i] - df[i]
+	}
+	if n == 0 {
+		return 0
+	}
+	return entropy(totals[:]) - withWord/n*entropy(with[:]) - (n-withWord)/n*entropy(without[:])
+}
+
+// entropy is the entropy in bits of the distribution given by the counts.
+func entropy(counts []float64) (retVal float64) {
+	var total float64
+	for _, c := range counts {
+		total += c
+	}
+	for _, c := range counts {
+		if c > 0 {
+			p := c / total
+			retVal -= p * math.Log2(p)
+		}
+	}
+	return
+}
+
+// docFreqs returns the number of documents of each class every word in the vocabulary appears in.
+// The classifier has to be locked.
+func (c *Classifier) docFreqs() map[int]*[MAXCLASS]float64 {
+	dfs := make(map[int]*[MAXCLASS]float64)
+	for i, t := range c.tfidfs {
+		for id, df := range t.TF {
+			if dfs[id] == nil {
+				dfs[id] = new([MAXCLASS]float64)
+			}
+			dfs[id][i] = df
+		}
+	}
+	return dfs
+}
+
+// PruneDF removes the words that appear in fewer than minDF documents, or in more than the
+// fraction maxDF of the documents. It returns the number of words removed.
+func (c *Classifier) PruneDF(minDF int, maxDF float64) int {
+	c.Lock()
+	defer c.Unlock()
+
+	var docs float64
+	for _, total := range c.totals {
+		docs += total
+	}
+	var ids []int
+	for id, df := range c.docFreqs() {
+		var sum float64
+		for _, n := range df {
+			sum += n
+		}
+		if sum < float64(minDF) || sum > maxDF*docs {
+			ids = append(ids, id)
+		}
+	}
+	c.prune(ids)
+	return len(ids)
+}
+
+// SelectFeatures keeps only the k words of the vocabulary that score highest, and removes the
+// rest. It returns the number of words removed.
+func (c *Classifier) SelectFeatures(k int, score FeatureScorer) int {
+	c.Lock()
+	defer c.Unlock()
+
+	type scored struct {
+		id    int
+		score float64
+	}
+	var words []scored
+	for id, df := range c.docFreqs() {
+		words = append(words, scored{id, score(*df, c.totals)})
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].score != words[j].score {
+			return words[i].score > words[j].score
+		}
+		return words[i].id < words[j].id
+	})
+	if len(words) <= k {
+		return 0
+	}
+
+	ids := make([]int, 0, len(words)-k)
+	for _, w := range words[k:] {
+		ids = append(ids, w.id)
+	}
+	c.prune(ids)
+	return len(ids)
+}
+
+// prune removes the words from the statistics of the classifier, and from its vocabulary. The
+// IDFs and the model are recalculated before the next prediction. The classifier has to be locked.
+//
+// Pruning fixes the vocabulary: training again only counts the words that were kept. A hashed
+// classifier remembers its pruned buckets instead.
+func (c *Classifier) prune(ids []int) {
+	if len(ids) == 0 {
+		return
+	}
+	for _, id := range ids {
+		for i, t := range c.tfidfs {
+			delete(t.TF, id)
+			delete(t.IDF, id)
+			c.tokens[i] -= c.counts[i][id]
+			delete(c.counts[i], id)
+		}
+		if c.hashed() {
+			c.pruned[id] = struct{}{}
+		}
+	}
+	if !c.hashed() {
+		c.compact()
+	}
+	c.ready = false
+}
+
+// compact removes the words that no class counts from the vocabulary, and renumbers the rest.
+// The classifier has to be locked.
+func (c *Classifier) compact() {
+	renumbered := make(map[int]int)
+	words := corpus.New()
+	for id := 0; id < c.corpus.Size(); id++ {
+		for i := range c.counts {
+			if _, ok := c.counts[i][id]; ok {
+				word, _ := c.corpus.Word(id)
+				renumbered[id] = words.Add(word)
+				break
+			}
+		}
+	}
+	renumber := func(m map[int]float64) map[int]float64 {
+		retVal := make(map[int]float64, len(m))
+		for id, v := range m {
+			retVal[renumbered[id]] = v
+		}
+		return retVal
+	}
+	for i, t := range c.tfidfs {
+		t.TF = renumber(t.TF)
+		t.IDF = renumber(t.IDF)
+		c.counts[i] = renumber(c.counts[i])
+	}
+	c.corpus = words
+	c.fixed = true
+}
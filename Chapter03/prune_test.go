@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/chewxy/lingo/corpus"
+)
+
+func TestFeatureScorers(t *testing.T) {
+	totals := [MAXCLASS]float64{10, 10}
+	perfect := [MAXCLASS]float64{0, 10}
+	useless := [MAXCLASS]float64{5, 5}
+
+	if ig := InformationGain(perfect, totals); math.Abs(ig-1) > 1e-12 {
+		t.Errorf("Expected a perfectly discriminating word to gain 1 bit. Got %v", ig)
+	}
+	if ig := InformationGain(useless, totals); math.Abs(ig) > 1e-12 {
+		t.Errorf("Expected an evenly spread word to gain nothing. Got %v", ig)
+	}
+	if chi2 := ChiSquare(perfect, totals); chi2 != 20 {
+		t.Errorf("Expected χ² of N = 20 for a perfectly discriminating word. Got %v", chi2)
+	}
+	if chi2 := ChiSquare(useless, totals); chi2 != 0 {
+		t.Errorf("Expected χ² of 0 for an evenly spread word. Got %v", chi2)
+	}
+}
+
+func TestPruning(t *testing.T) {
+	c, err := Construct(WithModel("multinomial"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Train(toyExamples)
+
+	// of the 24 words, only "now", "cheap", "buy", "the", "for", "on", "linguistics", "seminar"
+	// and "syntax" are in more than one document.
+	if n := c.PruneDF(2, 1); n != 15 {
+		t.Errorf("Expected 15 words in a single document to be pruned. Got %d", n)
+	}
+	if n := c.SelectFeatures(4, ChiSquare); n != 5 {
+		t.Errorf("Expected 5 of the 9 remaining words to be removed by selection. Got %d", n)
+	}
+	if c.wordID("now") < 0 {
+		t.Errorf("Expected the most discriminating word to be kept")
+	}
+	if c.wordID("viagra") >= 0 {
+		t.Errorf("Expected a word in a single document to be pruned")
+	}
+	if n := c.corpus.Size() - corpus.New().Size(); n != 4 {
+		t.Errorf("Expected the pruned words to be removed from the vocabulary of 4 words. Got %d", n)
+	}
+	for _, ex := range toyExamples {
+		if got := c.Predict(ex.Document); got != ex.Class {
+			t.Errorf("Expected %v for %q after pruning. Got %v", ex.Class, ex.Document, got)
+		}
+	}
+
+	c.Train(append(toyExamples[:1:1], Example{[]string{"brand", "new"}, Ham}))
+	if c.wordID("viagra") >= 0 || c.wordID("brand") >= 0 {
+		t.Errorf("Expected pruned and new words to be ignored when training again")
+	}
+
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.vocabSize() != c.vocabSize() || loaded.wordID("viagra") >= 0 {
+		t.Errorf("Expected the pruned vocabulary of %d words to be saved. Got %d", c.vocabSize(), loaded.vocabSize())
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/gob"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// modelMagic and modelVersion identify a saved Classifier. modelVersion has to be bumped
+// whenever the meaning of the saved statistics changes.
+const (
+	modelMagic   = "spamnb"
+	modelVersion = 8
+)
+
+type modelHeader struct {
+	Magic   string
+	Version int
+}
+
+// savedModel is the on-disk representation of a Classifier.
+type savedModel struct {
+	Config Config
+
+	// Words is the corpus vocabulary, indexed by word ID.
+	Words []string
+
+	TF     [MAXCLASS]map[int]float64
+	IDF    [MAXCLASS]map[int]float64
+	Docs   [MAXCLASS]int // documents seen per class
+	Totals [MAXCLASS]float64
+	Counts [MAXCLASS]map[int]float64
+	Tokens [MAXCLASS]float64
+
+	// Pruned are the buckets removed from a hashed classifier, and Fixed is whether pruning has
+	// fixed the vocabulary.
+	Pruned []int
+	Fixed  bool
+}
+
+// Save writes the classifier to w. The classifier is postprocessed first, so that a loaded
+// classifier is immediately ready for Predict.
+func (c *Classifier) Save(w io.Writer) error {
+	c.rlockReady()
+	defer c.RUnlock()
+
+	m := savedModel{
+		Config: c.Config,
+		Words:  make([]string, c.corpus.Size()),
+		Totals: c.totals,
+		Counts: c.counts,
+		Tokens: c.tokens,
+		Fixed:  c.fixed,
+	}
+	for i := range m.Words {
+		m.Words[i], _ = c.corpus.Word(i)
+	}
+	for id := range c.pruned {
+		m.Pruned = append(m.Pruned, id)
+	}
+	for i, t := range c.tfidfs {
+		m.TF[i] = t.TF
+		m.IDF[i] = t.IDF
+		m.Docs[i] = t.Docs
+	}
+
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(modelHeader{Magic: modelMagic, Version: modelVersion}); err != nil {
+		return errors.Wrap(err, "Unable to write model header")
+	}
+	return errors.Wrap(enc.Encode(m), "Unable to write model")
+}
+
+// Load reads a classifier written by Save. It fails if the file was written by a different
+// version of the model format.
+func Load(r io.Reader) (*Classifier, error) {
+	dec := gob.NewDecoder(r)
+	var h modelHeader
+	if err := dec.Decode(&h); err != nil {
+		return nil, errors.Wrap(err, "Unable to read model header")
+	}
+	if h.Magic != modelMagic {
+		return nil, errors.Errorf("Not a saved classifier (magic %q)", h.Magic)
+	}
+	if h.Version != modelVersion {
+		return nil, errors.Errorf("Unsupported model format version %d. Expected version %d", h.Version, modelVersion)
+	}
+
+	var m savedModel
+	if err := dec.Decode(&m); err != nil {
+		return nil, errors.Wrap(err, "Unable to read model")
+	}
+	if m.Config.Signed {
+		return nil, errors.New("The model uses signed hashing, which is no longer supported. Train it again")
+	}
+
+	c := newClassifier(m.Config)
+	c.totals = m.Totals
+	c.tokens = m.Tokens
+	c.fixed = m.Fixed
+	var err error
+	if c.model, err = modelByName(m.Config.Model); err != nil {
+		return nil, err
+	}
+	for i, w := range m.Words {
+		if id := c.corpus.Add(w); id != i {
+			return nil, errors.Errorf("Corrupt vocabulary: %q has ID %d, expected %d", w, id, i)
+		}
+	}
+	for i, t := range c.tfidfs {
+		if m.TF[i] != nil {
+			t.TF = m.TF[i]
+		}
+		if m.IDF[i] != nil {
+			t.IDF = m.IDF[i]
+		}
+		if m.Counts[i] != nil {
+			c.counts[i] = m.Counts[i]
+		}
+		t.Docs = m.Docs[i]
+	}
+	for _, id := range m.Pruned {
+		c.pruned[id] = struct{}{}
+	}
+	c.model.prepare(c)
+	c.ready = true
+	return c, nil
+}
+
+// SaveFile saves the classifier to the named file.
+func (c *Classifier) SaveFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = c.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadFile loads a classifier from the named file.
+func LoadFile(filename string) (*Classifier, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := Load(f)
+	return c, errors.WithMessage(err, filename)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// deliverer delivers a message to its recipients.
+type deliverer interface {
+	Deliver(from string, to []string, msg []byte) error
+}
+
+// relay delivers messages by forwarding them to an upstream SMTP server.
+type relay string
+
+func (r relay) Deliver(from string, to []string, msg []byte) error {
+	return smtp.SendMail(string(r), nil, from, to, msg)
+}
+
+// maildir delivers messages by writing them into a Maildir.
+type maildir string
+
+var deliveries uint64
+
+func (m maildir) Deliver(from string, to []string, msg []byte) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(string(m), sub), 0700); err != nil {
+			return err
+		}
+	}
+	host, _ := os.Hostname()
+	host = strings.NewReplacer("/", "\\057", ":", "\\072").Replace(host)
+	name := fmt.Sprintf("%d.P%dQ%d.%s", time.Now().Unix(), os.Getpid(), atomic.AddUint64(&deliveries, 1), host)
+
+	// a message is written to tmp first, so that readers of new never see half a message.
+	tmp := filepath.Join(string(m), "tmp", name)
+	if err := ioutil.WriteFile(tmp, msg, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(string(m), "new", name))
+}
+
+// spamFilter tags every message with the verdict of a classifier before handing it on.
+type spamFilter struct {
+	c    *Classifier
+	next deliverer
+}
+
+// Deliver adds the X-Spam-Flag, X-Spam-Score and X-Spam-Probability headers to the message and
+// delivers it. X-Spam-Score is the score margin of Spam over Ham, and X-Spam-Probability the
+// calibrated probability of Spam that is compared against the classifier's threshold. Any X-Spam-*
+// headers the message came with are removed, so that senders cannot pass off their own verdict.
+func (f spamFilter) Deliver(from string, to []string, msg []byte) error {
+	msg = stripSpamHeaders(msg)
+	doc := mailDocument(msg, NewTokenizer(f.c.Tokenizer))
+	f.c.rlockReady()
+	scores := f.c.score(doc)
+	class, prob := f.c.decide(scores), f.c.Calibration.prob(scores[Spam]-scores[Ham])
+	f.c.RUnlock()
+	verdict := "NO"
+	if class == Spam {
+		verdict = "YES"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "X-Spam-Flag: %s\n", verdict)
+	fmt.Fprintf(&buf, "X-Spam-Score: %.4f\n", scores[Spam]-scores[Ham])
+	fmt.Fprintf(&buf, "X-Spam-Probability: %.4f\n", prob)
+	buf.Write(msg)
+	return f.next.Deliver(from, to, buf.Bytes())
+}
+
+// stripSpamHeaders removes the X-Spam-* fields, with their continuation lines, from the header of
+// the message.
+func stripSpamHeaders(msg []byte) []byte {
+	var buf bytes.Buffer
+	rest := msg
+	dropping := false
+	for len(rest) > 0 {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			// the end of the header
+			break
+		}
+		rest = rest[len(line):]
+		if line[0] != ' ' && line[0] != '\t' {
+			dropping = len(line) >= len("X-Spam-") && strings.EqualFold(string(line[:len("X-Spam-")]), "X-Spam-")
+		}
+		if !dropping {
+			buf.Write(line)
+		}
+	}
+	buf.Write(rest)
+	return buf.Bytes()
+}
+
+// smtpServer is a minimal SMTP server (RFC 5321). Every message it accepts is handed to its
+// deliverer before it is acknowledged, so a message that cannot be delivered is refused.
+// Messages are handed over with LF line endings. Connections are handled concurrently.
+type smtpServer struct {
+	Hostname string
+	MaxSize  int // maximum message size in bytes
+	deliver  deliverer
+
+	listener net.Listener
+	closed   int32
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	sync.Mutex
+}
+
+func newSMTPServer(d deliverer) *smtpServer {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return &smtpServer{Hostname: host, MaxSize: 10 << 20, deliver: d, conns: make(map[net.Conn]struct{})}
+}
+
+// Listen starts listening on the TCP address.
+func (s *smtpServer) Listen(addr string) (err error) {
+	s.listener, err = net.Listen("tcp", addr)
+	return
+}
+
+// Addr is the address the server is listening on.
+func (s *smtpServer) Addr() net.Addr { return s.listener.Addr() }
+
+// ListenAndServe listens on the TCP address and serves connections until Close is called.
+func (s *smtpServer) ListenAndServe(addr string) error {
+	if err := s.Listen(addr); err != nil {
+		return err
+	}
+	return s.Serve()
+}
+
+// Serve accepts connections until Close is called.
+func (s *smtpServer) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if atomic.LoadInt32(&s.closed) == 1 {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		s.Lock()
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.Unlock()
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+			s.Lock()
+			delete(s.conns, conn)
+			s.Unlock()
+		}()
+	}
+}
+
+// Close stops accepting connections, closes the open ones, and waits for them to finish.
+func (s *smtpServer) Close() error {
+	atomic.StoreInt32(&s.closed, 1)
+	err := s.listener.Close()
+	s.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// smtpSession is the state of one SMTP transaction. from is empty both before MAIL and after the
+// null reverse-path of MAIL FROM:<>, which bounces are sent with, so mail tells them apart.
+type smtpSession struct {
+	helo bool
+	mail bool
+	from string
+	to   []string
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(format string, args ...interface{}) bool {
+		conn.SetWriteDeadline(time.Now().Add(time.Minute))
+		return tp.PrintfLine(format, args...) == nil
+	}
+
+	var sess smtpSession
+	if !reply("220 %s ESMTP spam filter ready", s.Hostname) {
+		return
+	}
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		var ok bool
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			sess = smtpSession{helo: true}
+			ok = reply("250 %s", s.Hostname)
+		case "EHLO":
+			sess = smtpSession{helo: true}
+			ok = reply("250-%s\r\n250-SIZE %d\r\n250 8BITMIME", s.Hostname, s.MaxSize)
+		case "MAIL":
+			switch addr, err := parsePath(arg, "FROM:"); {
+			case !sess.helo:
+				ok = reply("503 5.5.1 Send HELO or EHLO first")
+			case err != nil:
+				ok = reply("501 5.5.4 %v", err)
+			default:
+				sess.mail, sess.from, sess.to = true, addr, nil
+				ok = reply("250 2.1.0 OK")
+			}
+		case "RCPT":
+			switch addr, err := parsePath(arg, "TO:"); {
+			case !sess.mail:
+				ok = reply("503 5.5.1 Send MAIL first")
+			case err != nil || addr == "":
+				ok = reply("501 5.1.3 Bad recipient address")
+			default:
+				sess.to = append(sess.to, addr)
+				ok = reply("250 2.1.5 OK")
+			}
+		case "DATA":
+			if len(sess.to) == 0 {
+				ok = reply("503 5.5.1 Send RCPT first")
+				break
+			}
+			if !reply("354 Start mail input; end with <CRLF>.<CRLF>") {
+				return
+			}
+			ok = s.data(tp, conn, &sess, reply)
+		case "RSET":
+			sess = smtpSession{helo: sess.helo}
+			ok = reply("250 2.0.0 OK")
+		case "NOOP":
+			ok = reply("250 2.0.0 OK")
+		case "VRFY":
+			ok = reply("252 2.5.0 Cannot VRFY user")
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			ok = reply("502 5.5.2 Command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// data reads the message of a DATA command and delivers it.
+func (s *smtpServer) data(tp *textproto.Conn, conn net.Conn, sess *smtpSession, reply func(string, ...interface{}) bool) bool {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Minute))
+	dr := tp.DotReader()
+	msg, err := ioutil.ReadAll(io.LimitReader(dr, int64(s.MaxSize)+1))
+	if err != nil {
+		return false
+	}
+	from, to := sess.from, sess.to
+	*sess = smtpSession{helo: true}
+
+	if len(msg) > s.MaxSize {
+		// the rest of the message has to be read before the client listens to us again
+		if _, err := io.Copy(ioutil.Discard, dr); err != nil {
+			return false
+		}
+		return reply("552 5.3.4 Message too big")
+	}
+	if err := s.deliver.Deliver(from, to, msg); err != nil {
+		log.Printf("Unable to deliver message from %q: %v", from, err)
+		return reply("451 4.3.0 Unable to deliver message")
+	}
+	return reply("250 2.0.0 OK")
+}
+
+// parsePath parses the "FROM:<address>" and "TO:<address>" arguments of MAIL and RCPT.
+// Parameters after the address, such as BODY=8BITMIME, are ignored.
+func parsePath(arg, prefix string) (string, error) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", errors.Errorf("Expected %v<address>", prefix)
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(arg, "<") {
+		return "", errors.Errorf("Expected %v<address>", prefix)
+	}
+	end := strings.IndexByte(arg, '>')
+	if end < 0 {
+		return "", errors.Errorf("Unterminated address %q", arg)
+	}
+	return arg[1:end], nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/smtp"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recorder is a deliverer that keeps every message it is given.
+type recorder struct {
+	msgs [][]byte
+	to   [][]string
+	sync.Mutex
+}
+
+func (r *recorder) Deliver(from string, to []string, msg []byte) error {
+	r.Lock()
+	r.msgs = append(r.msgs, msg)
+	r.to = append(r.to, to)
+	r.Unlock()
+	return nil
+}
+
+// delivered returns the messages delivered so far, and their recipients. The acknowledgment of a
+// delivery comes back over the network, which does not order the reads after the writes, so the
+// recorder is read under its lock.
+func (r *recorder) delivered() (msgs [][]byte, to [][]string) {
+	r.Lock()
+	defer r.Unlock()
+	return append(msgs, r.msgs...), append(to, r.to...)
+}
+
+func startSMTP(t *testing.T, d deliverer) *smtpServer {
+	s := newSMTPServer(d)
+	if err := s.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	return s
+}
+
+func TestSMTPProxy(t *testing.T) {
+	c := New()
+	c.Train(toyExamples)
+
+	rec := new(recorder)
+	upstream := startSMTP(t, rec)
+	defer upstream.Close()
+	proxy := startSMTP(t, spamFilter{c, relay(upstream.Addr().String())})
+	defer proxy.Close()
+
+	bodies := []string{"buy cheap viagra now", "the syntax seminar is on friday"}
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msg := fmt.Sprintf("From: sender@example.com\r\nTo: rcpt@example.org\r\nSubject: %d\r\n\r\n%s\r\n.leading dot\r\n", i, bodies[i%2])
+			if err := smtp.SendMail(proxy.Addr().String(), nil, "sender@example.com", []string{"rcpt@example.org"}, []byte(msg)); err != nil {
+				t.Errorf("Message %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	msgs, to := rec.delivered()
+	if len(msgs) != n {
+		t.Fatalf("Expected %d messages upstream. Got %d", n, len(msgs))
+	}
+	for i, msg := range msgs {
+		if len(to[i]) != 1 || to[i][0] != "rcpt@example.org" {
+			t.Errorf("Unexpected recipients %v", to[i])
+		}
+		e, err := ParseEmail(bytes.NewReader(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "NO"
+		if strings.Contains(e.Text, "viagra") {
+			expected = "YES"
+		}
+		if flag := e.Header.Get("X-Spam-Flag"); flag != expected {
+			t.Errorf("Expected X-Spam-Flag %v for %q. Got %q", expected, e.Text, flag)
+		}
+		if e.Header.Get("X-Spam-Score") == "" {
+			t.Errorf("Expected an X-Spam-Score header in %q", msg)
+		}
+		if !strings.Contains(e.Text, "\n.leading dot") {
+			t.Errorf("Expected the dot stuffing to be undone in %q", e.Text)
+		}
+	}
+}
+
+func TestSMTPMaildir(t *testing.T) {
+	c := New()
+	c.Train(toyExamples)
+	dir := filepath.Join(t.TempDir(), "Maildir")
+	proxy := startSMTP(t, spamFilter{c, maildir(dir)})
+	defer proxy.Close()
+
+	msg := "From: sender@example.com\r\nSubject: hi\r\n\r\nwin money now\r\n"
+	if err := smtp.SendMail(proxy.Addr().String(), nil, "sender@example.com", []string{"rcpt@example.org"}, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	exs, err := loadMail(dir, Spam, NewTokenizer(DefaultTokenizerConfig()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exs) != 1 {
+		t.Errorf("Expected 1 message in the Maildir. Got %d", len(exs))
+	}
+}
+
+func TestSMTPSequence(t *testing.T) {
+	s := startSMTP(t, new(recorder))
+	defer s.Close()
+	client, err := smtp.Dial(s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Rcpt("rcpt@example.org"); err == nil {
+		t.Errorf("Expected RCPT before MAIL to fail")
+	}
+	if err := client.Mail("sender@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Data(); err == nil {
+		t.Errorf("Expected DATA before RCPT to fail")
+	}
+	if err := client.Quit(); err != nil {
+		t.Error(err)
+	}
+
+	// bounces are sent with the null reverse-path
+	rec := new(recorder)
+	bounces := startSMTP(t, rec)
+	defer bounces.Close()
+	msg := "From: MAILER-DAEMON@example.com\r\nSubject: Undeliverable\r\n\r\nreturned mail\r\n"
+	if err := smtp.SendMail(bounces.Addr().String(), nil, "", []string{"sender@example.com"}, []byte(msg)); err != nil {
+		t.Fatalf("Expected MAIL FROM:<> to be accepted. Got %v", err)
+	}
+	if msgs, _ := rec.delivered(); len(msgs) != 1 {
+		t.Errorf("Expected the bounce to be delivered. Got %d messages", len(msgs))
+	}
+}
+
+func TestSMTPStripsSpamHeaders(t *testing.T) {
+	c := New()
+	c.Train(toyExamples)
+	rec := new(recorder)
+	proxy := startSMTP(t, spamFilter{c, rec})
+	defer proxy.Close()
+
+	msg := "X-Spam-Flag: NO\r\nFrom: sender@example.com\r\nx-spam-status: No,\r\n\tscore=-100\r\nSubject: hi\r\n\r\nbuy cheap viagra now\r\nX-Spam-Flag: NO\r\n"
+	if err := smtp.SendMail(proxy.Addr().String(), nil, "sender@example.com", []string{"rcpt@example.org"}, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := rec.delivered()
+	if len(msgs) != 1 {
+		t.Fatalf("Expected the message to be delivered. Got %d messages", len(msgs))
+	}
+	e, err := ParseEmail(bytes.NewReader(msgs[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags := e.Header["X-Spam-Flag"]; len(flags) != 1 || flags[0] != "YES" {
+		t.Errorf("Expected only our X-Spam-Flag: YES. Got %q", flags)
+	}
+	if status := e.Header.Get("X-Spam-Status"); status != "" {
+		t.Errorf("Expected the sender's X-Spam-Status to be removed. Got %q", status)
+	}
+	if e.Header.Get("Subject") != "hi" || !strings.Contains(e.Text, "X-Spam-Flag: NO") {
+		t.Errorf("Expected the other headers and the body to be kept. Got %q", msgs[0])
+	}
+}
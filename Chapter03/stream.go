@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Ingester reads the files of a dataset with a bounded pool of workers, and streams the examples
+// as they are read. The examples are always delivered in a deterministic order: the order the
+// dataset lists its files in, or, when Seed is set, that order shuffled by Seed.
+type Ingester struct {
+	// Workers is the number of files read and tokenized at once. It defaults to GOMAXPROCS.
+	Workers int
+
+	// Seed shuffles the files when it is not 0.
+	Seed int64
+}
+
+// ingested is the outcome of reading one source.
+type ingested struct {
+	ex  Example
+	err error
+}
+
+// Stream starts reading the dataset, and returns the channel the examples are delivered on. The
+// channel is closed once every file has been read. wait blocks until then, and returns the errors
+// of the files that could not be read as an errList, which do not stop the other files from
+// being read.
+//
+// Datasets that do not consist of one message per file are loaded whole, and then streamed.
+func (in Ingester) Stream(ds Dataset, tok *Tokenizer) (examples <-chan Example, wait func() error) {
+	workers := in.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	out := make(chan Example, workers)
+	done := make(chan struct{})
+	var err error
+	wait = func() error {
+		<-done
+		return err
+	}
+
+	fds, ok := ds.(fileDataset)
+	if !ok {
+		go func() {
+			defer close(done)
+			defer close(out)
+			var exs []Example
+			exs, err = ds.Load(tok)
+			if in.Seed != 0 {
+				r := rand.New(rand.NewSource(in.Seed))
+				r.Shuffle(len(exs), func(i, j int) { exs[i], exs[j] = exs[j], exs[i] })
+			}
+			for _, ex := range exs {
+				out <- ex
+			}
+		}()
+		return out, wait
+	}
+
+	go func() {
+		defer close(done)
+		defer close(out)
+		srcs, serr := fds.sources()
+		if serr != nil {
+			err = serr
+			return
+		}
+		if in.Seed != 0 {
+			r := rand.New(rand.NewSource(in.Seed))
+			r.Shuffle(len(srcs), func(i, j int) { srcs[i], srcs[j] = srcs[j], srcs[i] })
+		}
+		err = in.stream(srcs, tok, workers, out)
+	}()
+	return out, wait
+}
+
+// stream reads the sources with the workers, and sends the examples to out in the order of the
+// sources. Every source has its own result channel, which are queued in order; the queue bounds
+// how far the workers can get ahead of the slowest file.
+func (in Ingester) stream(srcs []source, tok *Tokenizer, workers int, out chan<- Example) error {
+	jobs := make(chan int)
+	results := make([]chan ingested, len(srcs))
+	queue := make(chan chan ingested, 2*workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				src := srcs[i]
+				ex, err := src.read(src.path, src.class, tok)
+				results[i] <- ingested{ex, errors.WithMessage(err, src.path)}
+			}
+		}()
+	}
+	go func() {
+		for i := range srcs {
+			results[i] = make(chan ingested, 1)
+			queue <- results[i]
+			jobs <- i
+		}
+		close(jobs)
+		close(queue)
+	}()
+
+	var errs errList
+	for result := range queue {
+		r := <-result
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		out <- r.ex
+	}
+	wg.Wait()
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// Load reads the whole dataset with the workers.
+func (in Ingester) Load(ds Dataset, tok *Tokenizer) (examples []Example, err error) {
+	ch, wait := in.Stream(ds, tok)
+	for ex := range ch {
+		examples = append(examples, ex)
+	}
+	return examples, wait()
+}
+
+// TrainStream trains the classifier on examples as they arrive, until the channel is closed. The
+// classifier can be used for prediction while it is training. It returns the number of examples
+// trained on.
+func (c *Classifier) TrainStream(examples <-chan Example) (n int) {
+	for ex := range examples {
+		c.Lock()
+		c.trainOne(ex)
+		c.ready = false
+		c.Unlock()
+		n++
+	}
+	return
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIngesterStream(t *testing.T) {
+	dir := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("lemm/part1/%03dmsg.txt", i)] = fmt.Sprintf("Subject: ham %d", i)
+		files[fmt.Sprintf("lemm/part2/spmsg%03d.txt", i)] = fmt.Sprintf("Subject: spam %d", i)
+	}
+	writeFiles(t, dir, files)
+	ds := Lingspam{Dir: dir, Variant: "lemm", Start: 0, End: 3}
+	tok := NewTokenizer(DefaultTokenizerConfig())
+
+	sequential, err := ds.Load(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := Ingester{Workers: 8}.Load(ds, tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parallel, sequential) {
+		t.Errorf("Expected the examples in the order of the files")
+	}
+
+	first, _ := Ingester{Workers: 8, Seed: 42}.Load(ds, tok)
+	second, _ := Ingester{Workers: 3, Seed: 42}.Load(ds, tok)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected the same order with the same seed")
+	}
+	if reflect.DeepEqual(first, sequential) || len(first) != len(sequential) {
+		t.Errorf("Expected the seed to shuffle the %d examples", len(sequential))
+	}
+
+	// a file that cannot be read is reported, and the rest are still streamed.
+	srcs, _ := ds.sources()
+	srcs = append(srcs[:10], append([]source{{filepath.Join(dir, "missing.txt"), Ham, readText}}, srcs[10:]...)...)
+	out := make(chan Example)
+	go func() {
+		for range out {
+		}
+	}()
+	err = Ingester{}.stream(srcs, tok, 4, out)
+	close(out)
+	if el, ok := err.(errList); !ok || len(el) != 1 {
+		t.Errorf("Expected one error for the missing file. Got %v", err)
+	}
+
+	c := New()
+	ch, wait := Ingester{Workers: 4}.Stream(ds, tok)
+	if n := c.TrainStream(ch); n != 100 {
+		t.Errorf("Expected to train on 100 examples. Got %d", n)
+	}
+	if err := wait(); err != nil {
+		t.Error(err)
+	}
+	if c.Predict([]string{"spam"}) != Spam {
+		t.Errorf("Expected the streamed examples to be trained on")
+	}
+}
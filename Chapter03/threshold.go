@@ -0,0 +1,143 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Calibration maps the score margin m of Spam over Ham to a probability of Spam with Platt
+// scaling: P(Spam) = 1 / (1 + exp(A·m + B)). A = -1, B = 0 treats the scores as log probabilities.
+type Calibration struct {
+	A, B float64
+}
+
+// prob is the calibrated probability of Spam given the score margin.
+func (cal Calibration) prob(margin float64) float64 {
+	return sigmoid(-(cal.A*margin + cal.B))
+}
+
+// CostMatrix is the cost of each kind of decision, indexed by the actual class, then the predicted class.
+type CostMatrix [MAXCLASS][MAXCLASS]float64
+
+// ThresholdChooser picks a threshold on the probability of Spam, given the calibrated
+// probabilities of a set of validation examples and their actual classes.
+type ThresholdChooser func(probs []float64, classes []Class) float64
+
+// WithThreshold sets the probability of Spam above which a document is classified as Spam.
+func WithThreshold(t float64) ConsOpt {
+	return func(c *Classifier) error {
+		if t < 0 || t > 1 {
+			return errors.Errorf("The threshold has to be in [0, 1]. Got %v", t)
+		}
+		c.Threshold = t
+		return nil
+	}
+}
+
+// SpamProb is the calibrated probability that the document is spam.
+func (c *Classifier) SpamProb(document []string) float64 {
+	c.rlockReady()
+	defer c.RUnlock()
+	scores := c.score(document)
+	return c.Calibration.prob(scores[Spam] - scores[Ham])
+}
+
+// decide classifies a document by its scores: Spam when its calibrated probability of Spam is
+// above the threshold. The classifier has to be read-locked.
+func (c *Classifier) decide(scores [MAXCLASS]float64) Class {
+	if c.Calibration.prob(scores[Spam]-scores[Ham]) > c.Threshold {
+		return Spam
+	}
+	return Ham
+}
+
+// Tune calibrates the probabilities of the classifier on validation examples, and then sets the
+// threshold to the one chosen on them. The validation examples should not have been trained on.
+func (c *Classifier) Tune(validation []Example, choose ThresholdChooser) error {
+	if len(validation) == 0 {
+		return errors.New("Cannot tune the threshold without validation examples")
+	}
+	margins := make([]float64, len(validation))
+	labels := make([]float64, len(validation))
+	classes := make([]Class, len(validation))
+	for i, ex := range validation {
+		scores := c.Score(ex.Document)
+		margins[i] = scores[Spam] - scores[Ham]
+		labels[i] = -1
+		if ex.Class == Spam {
+			labels[i] = 1
+		}
+		classes[i] = ex.Class
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	A, B := plattScaling(margins, labels)
+	c.Calibration = Calibration{A, B}
+	probs := make([]float64, len(margins))
+	for i, m := range margins {
+		probs[i] = c.Calibration.prob(m)
+	}
+	c.Threshold = choose(probs, classes)
+	return nil
+}
+
+// MaxFPR chooses the lowest threshold that flags at most the given fraction of ham as spam.
+func MaxFPR(rate float64) ThresholdChooser {
+	return func(probs []float64, classes []Class) float64 {
+		var hams []float64
+		for i, p := range probs {
+			if classes[i] == Ham {
+				hams = append(hams, p)
+			}
+		}
+		if len(hams) == 0 {
+			return 0
+		}
+		sort.Sort(sort.Reverse(sort.Float64Slice(hams)))
+		allowed := int(math.Floor(rate * float64(len(hams))))
+		if allowed >= len(hams) {
+			return 0
+		}
+		// a document is flagged when its probability is above the threshold, so at most
+		// `allowed` hams are above hams[allowed].
+		return hams[allowed]
+	}
+}
+
+// MinCost chooses the threshold with the lowest total cost on the validation examples.
+// Of equally costly thresholds, the highest is chosen.
+func MinCost(costs CostMatrix) ThresholdChooser {
+	return func(probs []float64, classes []Class) float64 {
+		order := make([]int, len(probs))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool { return probs[order[a]] > probs[order[b]] })
+
+		// start with nothing flagged, and flag the examples from the most probable spam down.
+		var cost float64
+		for _, class := range classes {
+			cost += costs[class][Ham]
+		}
+		best, threshold := cost, 1.0
+		for i := 0; i < len(order); {
+			p := probs[order[i]]
+			for ; i < len(order) && probs[order[i]] == p; i++ {
+				class := classes[order[i]]
+				cost += costs[class][Spam] - costs[class][Ham]
+			}
+			// the threshold lies halfway to the next lower probability.
+			next := 0.0
+			if i < len(order) {
+				next = probs[order[i]]
+			}
+			if cost < best {
+				best, threshold = cost, (p+next)/2
+			}
+		}
+		return threshold
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestThresholdChoosers(t *testing.T) {
+	probs := []float64{0.9, 0.8, 0.7, 0.6, 0.4, 0.3, 0.2, 0.1}
+	classes := []Class{Spam, Spam, Ham, Spam, Ham, Spam, Ham, Ham}
+
+	// 1 of the 4 hams may be flagged: the threshold is the second most probable ham.
+	if th := MaxFPR(0.25)(probs, classes); th != 0.4 {
+		t.Errorf("Expected a threshold of 0.4 for an FPR of 0.25. Got %v", th)
+	}
+	if th := MaxFPR(0)(probs, classes); th != 0.7 {
+		t.Errorf("Expected a threshold of 0.7 for an FPR of 0. Got %v", th)
+	}
+
+	// when losing ham is expensive, only the two most probable spams are flagged.
+	costly := CostMatrix{Ham: {Spam: 10}, Spam: {Ham: 1}}
+	if th := MinCost(costly)(probs, classes); th != 0.75 {
+		t.Errorf("Expected a threshold of 0.75 when false positives cost 10. Got %v", th)
+	}
+	// when missing spam is expensive, everything down to the least probable spam is flagged.
+	cheap := CostMatrix{Ham: {Spam: 1}, Spam: {Ham: 10}}
+	if th := MinCost(cheap)(probs, classes); th != 0.25 {
+		t.Errorf("Expected a threshold of 0.25 when false negatives cost 10. Got %v", th)
+	}
+}
+
+func TestTune(t *testing.T) {
+	c, err := Construct(WithModel("multinomial"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Train(toyExamples)
+	if c.Predict(toyExamples[0].Document) != Spam || c.Predict(toyExamples[3].Document) != Ham {
+		t.Fatal("Expected the default threshold to classify the training examples correctly")
+	}
+
+	validation := []Example{
+		{[]string{"buy", "cheap", "papers", "now"}, Spam},
+		{[]string{"cheap", "seminar", "notes", "now"}, Ham},
+		{[]string{"win", "the", "seminar"}, Ham},
+		{[]string{"click", "here", "for", "watches"}, Spam},
+	}
+	if err := c.Tune(validation, MaxFPR(0)); err != nil {
+		t.Fatal(err)
+	}
+	if r := evaluate("tuned", c, validation); r.Confusion[Ham][Spam] != 0 {
+		t.Errorf("Expected no false positives after tuning for an FPR of 0. Got %v", r.Confusion)
+	}
+	for _, ex := range validation {
+		if p := c.SpamProb(ex.Document); p <= 0 || p >= 1 {
+			t.Errorf("Expected a probability in (0, 1) for %q. Got %v", ex.Document, p)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Threshold != c.Threshold || loaded.Calibration != c.Calibration {
+		t.Errorf("Expected the threshold %v and calibration %v to be saved. Got %v and %v", c.Threshold, c.Calibration, loaded.Threshold, loaded.Calibration)
+	}
+
+	if err := c.Tune(nil, MaxFPR(0)); err == nil {
+		t.Error("Expected an error when tuning without validation examples")
+	}
+}
+
+// sliceDataset is a dataset of examples in memory.
+type sliceDataset []Example
+
+func (ds sliceDataset) Load(tok *Tokenizer) ([]Example, error) {
+	return append([]Example(nil), ds...), nil
+}
+
+func TestHoldOut(t *testing.T) {
+	var ds sliceDataset
+	for i := 0; i < 30; i++ {
+		ds = append(ds, Example{[]string{strings.Repeat("x", i+1)}, Class(i % 2)})
+	}
+
+	// -tune reloads the examples in the order of the seed of the model, and must get the same held
+	// out examples the model was not trained on
+	first, _ := Ingester{Workers: 4, Seed: 7}.Load(ds, nil)
+	again, _ := Ingester{Workers: 1, Seed: 7}.Load(ds, nil)
+	train, test := holdOut(first)
+	_, retest := holdOut(again)
+	if len(train) != 20 || len(test) != 10 {
+		t.Fatalf("Expected 20 examples to train on and 10 held out. Got %d and %d", len(train), len(test))
+	}
+	trained := make(map[string]bool)
+	for _, ex := range train {
+		trained[ex.Document[0]] = true
+	}
+	for i, ex := range test {
+		if trained[ex.Document[0]] {
+			t.Errorf("Held out example %v was trained on", ex.Document)
+		}
+		if retest[i].Document[0] != ex.Document[0] {
+			t.Errorf("Expected the same seed to hold out the same examples")
+			break
+		}
+	}
+}
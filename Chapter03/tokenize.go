@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/kljensen/snowball/english"
+	"github.com/pkg/errors"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NumberMode says what a Tokenizer does with tokens that are made up of digits.
+type NumberMode byte
+
+const (
+	KeepNumbers     NumberMode = iota
+	DropNumbers                // remove numbers
+	CollapseNumbers            // replace every number with numberToken
+)
+
+const numberToken = "<NUM>"
+
+func parseNumberMode(a string) (NumberMode, error) {
+	switch a {
+	case "keep":
+		return KeepNumbers, nil
+	case "drop":
+		return DropNumbers, nil
+	case "collapse":
+		return CollapseNumbers, nil
+	}
+	return KeepNumbers, errors.Errorf("Expected only \"keep\", \"drop\" or \"collapse\". Got %q", a)
+}
+
+// TokenizerConfig configures the text preprocessing pipeline. It is saved as part of a
+// classifier's Config, so that text is tokenized the same way for training and prediction.
+// The zero value splits text on whitespace and does nothing else.
+type TokenizerConfig struct {
+	Normalize  bool // Unicode NFKC normalization, with diacritics removed
+	Lowercase  bool
+	StripPunct bool // split words on punctuation, and remove the punctuation
+	Numbers    NumberMode
+	Stopwords  bool // remove stopwords
+	Stem       bool // Snowball (Porter2) stemming of English words
+	NGrams     int  // if greater than 1, word n-grams up to this length are added after the words
+
+	Fold       bool // fold homoglyphs and leetspeak into plain letters, so "V1аgra" is "Viagra"
+	CharNGrams int  // if greater than 0, character n-grams of this length of the words are added
+	Patterns   bool // add counts of suspicious patterns of the raw text: URLs, runs of capitals and currency symbols
+}
+
+// DefaultTokenizerConfig is the configuration used by New.
+func DefaultTokenizerConfig() TokenizerConfig {
+	return TokenizerConfig{
+		Normalize:  true,
+		Lowercase:  true,
+		StripPunct: true,
+		Numbers:    CollapseNumbers,
+	}
+}
+
+// Tokenizer turns raw text into the words of an Example. It is safe for concurrent use.
+type Tokenizer struct {
+	TokenizerConfig
+}
+
+func NewTokenizer(conf TokenizerConfig) *Tokenizer { return &Tokenizer{conf} }
+
+// Tokenize runs the pipeline over the text.
+func (t *Tokenizer) Tokenize(text string) []string {
+	var patterns []string
+	if t.Patterns {
+		patterns = suspiciousPatterns(text)
+	}
+	if t.Fold {
+		if s, _, err := transform.String(foldHomoglyphs(), text); err == nil {
+			text = s
+		}
+		text = foldLeet(text)
+	}
+	if t.Normalize {
+		// transformers are stateful, so a new one is needed for every call.
+		tr := transform.Chain(norm.NFD, transform.RemoveFunc(isMn), norm.NFKC)
+		if s, _, err := transform.String(tr, text); err == nil {
+			text = s
+		}
+	}
+	if t.Lowercase {
+		text = strings.ToLower(text)
+	}
+
+	var fields []string
+	if t.StripPunct {
+		fields = strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	} else {
+		fields = strings.Fields(text)
+	}
+
+	words := fields[:0]
+	for _, word := range fields {
+		if isNumber(word) {
+			switch t.Numbers {
+			case DropNumbers:
+				continue
+			case CollapseNumbers:
+				word = numberToken
+			}
+		}
+		if t.Stopwords {
+			if _, ok := stopwords[strings.ToLower(word)]; ok {
+				continue
+			}
+		}
+		if t.Stem && word != numberToken {
+			word = english.Stem(word, false)
+		}
+		words = append(words, word)
+	}
+	var chars []string
+	if t.CharNGrams > 0 {
+		chars = charNGrams(words, t.CharNGrams)
+	}
+	words = ngrams(words, t.NGrams)
+	words = append(words, chars...)
+	return append(words, patterns...)
+}
+
+// ngrams appends the word n-grams of length 2 to n to the words.
+func ngrams(words []string, n int) []string {
+	retVal := words
+	for k := 2; k <= n; k++ {
+		for i := 0; i+k <= len(words); i++ {
+			retVal = append(retVal, strings.Join(words[i:i+k], "_"))
+		}
+	}
+	return retVal
+}
+
+func isNumber(a string) bool {
+	for _, r := range a {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return a != ""
+}
+
+// isMn returns true if it's a non-spacing mark
+func isMn(r rune) bool {
+	return unicode.Is(unicode.Mn, r)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+var tokenizeTests = []struct {
+	conf     TokenizerConfig
+	text     string
+	expected []string
+}{
+	{TokenizerConfig{}, "Buy NOW!\nCheap  pills", []string{"Buy", "NOW!", "Cheap", "pills"}},
+	{DefaultTokenizerConfig(), "Buy NOW!\nCheap café, 100 pills", []string{"buy", "now", "cheap", "cafe", "<NUM>", "pills"}},
+	{TokenizerConfig{Lowercase: true, StripPunct: true, Numbers: DropNumbers, Stopwords: true}, "The 2 offers are for you", []string{"offers"}},
+	{TokenizerConfig{Lowercase: true, StripPunct: true, Stem: true}, "Running offers", []string{"run", "offer"}},
+	{TokenizerConfig{Lowercase: true, NGrams: 3}, "click here now", []string{"click", "here", "now", "click_here", "here_now", "click_here_now"}},
+	{TokenizerConfig{Normalize: true}, "ﬁnancial", []string{"financial"}},
+	{TokenizerConfig{Fold: true, Lowercase: true, StripPunct: true}, "Buy V1аgra and Ｃ1@l1s in 2018, win!", []string{"buy", "viagra", "and", "cialis", "in", "2018", "win"}},
+	{TokenizerConfig{Lowercase: true, CharNGrams: 3}, "Free", []string{"free", "c:<fr", "c:fre", "c:ree", "c:ee>"}},
+	{TokenizerConfig{Lowercase: true, StripPunct: true, Patterns: true}, "ACT NOW and FREE MONEY: $100 at http://x.com", []string{"act", "now", "and", "free", "money", "100", "at", "http", "x", "com", "urls:1", "caps:2-4", "currency:1"}},
+}
+
+func TestTokenizer(t *testing.T) {
+	for i, tt := range tokenizeTests {
+		got := NewTokenizer(tt.conf).Tokenize(tt.text)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Test %d: Expected %q. Got %q", i, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize"
+)
+
+// arimaOrder is the order of a seasonal ARIMA(p,d,q)(P,D,Q)m model.
+type arimaOrder struct {
+	P, D, Q    int // the orders of the autoregression, the differencing and the moving average
+	SP, SD, SQ int // the seasonal orders
+	Period     int
+}
+
+// parseARIMAOrder parses "p,d,q" or "p,d,q,P,D,Q". The period is that of the series.
+func parseARIMAOrder(s string, period int) (arimaOrder, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 3 && len(fields) != 6 {
+		return arimaOrder{}, errors.Errorf("Unable to parse ARIMA order %q. Expected p,d,q or p,d,q,P,D,Q", s)
+	}
+	orders := make([]int, 6)
+	for i, f := range fields {
+		o, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || o < 0 {
+			return arimaOrder{}, errors.Errorf("Unable to parse ARIMA order %q. Expected non-negative integers", s)
+		}
+		orders[i] = o
+	}
+	return arimaOrder{orders[0], orders[1], orders[2], orders[3], orders[4], orders[5], period}, nil
+}
+
+func (o arimaOrder) String() string {
+	if o.SP == 0 && o.SD == 0 && o.SQ == 0 {
+		return fmt.Sprintf("ARIMA(%d,%d,%d)", o.P, o.D, o.Q)
+	}
+	return fmt.Sprintf("ARIMA(%d,%d,%d)(%d,%d,%d)[%d]", o.P, o.D, o.Q, o.SP, o.SD, o.SQ, o.Period)
+}
+
+func (o arimaOrder) seasonal() bool { return o.SP > 0 || o.SD > 0 || o.SQ > 0 }
+
+// hasMean reports whether the model has a mean: only undifferenced models have one.
+func (o arimaOrder) hasMean() bool { return o.D == 0 && o.SD == 0 }
+
+// lost is the number of observations lost to differencing.
+func (o arimaOrder) lost() int { return o.D + o.SD*o.Period }
+
+// arimaMethod is how the parameters of an ARIMA model are estimated.
+type arimaMethod string
+
+const (
+	arimaCSS   arimaMethod = "css"    // conditional sum of squares
+	arimaML    arimaMethod = "ml"     // exact maximum likelihood, with a Kalman filter
+	arimaCSSML arimaMethod = "css-ml" // exact maximum likelihood, starting from the CSS estimates
+)
+
+// arima is an ARIMA model fitted to a series.
+type arima struct {
+	arimaOrder
+	Method arimaMethod
+
+	AR, MA, SAR, SMA []float64 // the coefficients: (1 - φ₁B - ...)(1 - Φ₁Bᵐ - ...) and (1 + θ₁B + ...)(1 + Θ₁Bᵐ + ...)
+	Mean             float64
+
+	Sigma2 float64
+	LogLik float64
+	AIC    float64
+
+	Residuals []float64 // the residuals, from the conditional recursion; the first ones are zero
+
+	y      []float64
+	ar, ma []float64 // the AR and MA coefficients of the expanded polynomials
+}
+
+// numParams is the number of coefficients of the model, with the mean.
+func (o arimaOrder) numParams() int {
+	k := o.P + o.Q + o.SP + o.SQ
+	if o.hasMean() {
+		k++
+	}
+	return k
+}
+
+// unpack turns the unconstrained parameters the optimizer works with into the coefficients of the
+// model. The autoregressions are kept stationary and the moving averages invertible by
+// parameterizing them by their partial autocorrelations (Jones, 1980).
+func (o arimaOrder) unpack(x []float64) (ar, ma, sar, sma []float64, mean float64) {
+	ar, x = partrans(x[:o.P]), x[o.P:]
+	ma, x = negate(partrans(x[:o.Q])), x[o.Q:]
+	sar, x = partrans(x[:o.SP]), x[o.SP:]
+	sma, x = negate(partrans(x[:o.SQ])), x[o.SQ:]
+	if o.hasMean() {
+		mean = x[0]
+	}
+	return
+}
+
+// pack is the inverse of unpack.
+func (o arimaOrder) pack(ar, ma, sar, sma []float64, mean float64) []float64 {
+	x := invPartrans(ar)
+	x = append(x, invPartrans(negate(ma))...)
+	x = append(x, invPartrans(sar)...)
+	x = append(x, invPartrans(negate(sma))...)
+	if o.hasMean() {
+		x = append(x, mean)
+	}
+	return x
+}
+
+// partrans maps unconstrained values onto the coefficients of a stationary autoregression, through
+// the partial autocorrelations tanh(u) and the Durbin-Levinson recursion.
+func partrans(u []float64) []float64 {
+	phi := make([]float64, len(u))
+	prev := make([]float64, len(u))
+	for k := range u {
+		r := math.Tanh(u[k])
+		copy(prev, phi)
+		phi[k] = r
+		for j := 0; j < k; j++ {
+			phi[j] = prev[j] - r*prev[k-1-j]
+		}
+	}
+	return phi
+}
+
+// invPartrans is the inverse of partrans.
+func invPartrans(phi []float64) []float64 {
+	phi = append([]float64(nil), phi...)
+	u := make([]float64, len(phi))
+	prev := make([]float64, len(phi))
+	for k := len(phi) - 1; k >= 0; k-- {
+		r := math.Max(-0.999, math.Min(0.999, phi[k]))
+		u[k] = math.Atanh(r)
+		copy(prev, phi)
+		for j := 0; j < k; j++ {
+			phi[j] = (prev[j] + r*prev[k-1-j]) / (1 - r*r)
+		}
+	}
+	return u
+}
+
+func negate(a []float64) []float64 {
+	retVal := make([]float64, len(a))
+	for i, v := range a {
+		retVal[i] = -v
+	}
+	return retVal
+}
+
+// expand multiplies out the non-seasonal and seasonal polynomials. sign is -1 for the
+// autoregressions, (1 - φ₁B - ...), and 1 for the moving averages, (1 + θ₁B + ...). It returns the
+// coefficients of the product in the same form, without the leading 1.
+func expand(coef, seasonal []float64, period int, sign float64) []float64 {
+	a := make([]float64, len(coef)+1)
+	a[0] = 1
+	for i, c := range coef {
+		a[i+1] = sign * c
+	}
+	b := make([]float64, len(seasonal)*period+1)
+	b[0] = 1
+	for i, c := range seasonal {
+		b[(i+1)*period] = sign * c
+	}
+	prod := polyMul(a, b)
+	retVal := make([]float64, len(prod)-1)
+	for i := range retVal {
+		retVal[i] = sign * prod[i+1]
+	}
+	return retVal
+}
+
+func polyMul(a, b []float64) []float64 {
+	retVal := make([]float64, len(a)+len(b)-1)
+	for i := range a {
+		for j := range b {
+			retVal[i+j] += a[i] * b[j]
+		}
+	}
+	return retVal
+}
+
+// cssResiduals are the residuals of the ARMA model of the differenced series w, conditional on the
+// first len(ar) observations, whose residuals are zero.
+func cssResiduals(w, ar, ma []float64) []float64 {
+	e := make([]float64, len(w))
+	for t := len(ar); t < len(w); t++ {
+		v := w[t]
+		for i, a := range ar {
+			v -= a * w[t-1-i]
+		}
+		for j, b := range ma {
+			if t-1-j >= 0 {
+				v -= b * e[t-1-j]
+			}
+		}
+		e[t] = v
+	}
+	return e
+}
+
+// cssLogLik is the log likelihood of the model conditioned on the first cond observations, or on
+// as many as the autoregression needs if that is more, with the variance concentrated out.
+func cssLogLik(w, ar, ma []float64, cond int) (ll, sigma2 float64) {
+	if cond < len(ar) {
+		cond = len(ar)
+	}
+	e := cssResiduals(w, ar, ma)
+	n := float64(len(w) - cond)
+	for _, v := range e[cond:] {
+		sigma2 += v * v
+	}
+	sigma2 /= n
+	return -0.5 * n * (math.Log(2*math.Pi*sigma2) + 1), sigma2
+}
+
+// exactLogLik is the exact Gaussian log likelihood of the ARMA model of w, with the variance
+// concentrated out. It is calculated with the Kalman filter of the state space form of Harvey
+// (1989), whose state transition is the companion matrix of the autoregression.
+func exactLogLik(w, ar, ma []float64) (ll, sigma2 float64, err error) {
+	r := len(ar)
+	if len(ma)+1 > r {
+		r = len(ma) + 1
+	}
+	phi := make([]float64, r)
+	copy(phi, ar)
+	g := make([]float64, r)
+	g[0] = 1
+	copy(g[1:], ma)
+
+	p, err := stationaryCovariance(phi, g)
+	if err != nil {
+		return 0, 0, err
+	}
+	a := make([]float64, r)
+	tmp := make([]float64, r*r)
+	var ssq, sumLogF float64
+	steady := false
+	for _, wt := range w {
+		f := p[0]
+		if f <= 0 {
+			return 0, 0, errors.New("The Kalman filter diverged")
+		}
+		v := wt - a[0]
+		ssq += v * v / f
+		sumLogF += math.Log(f)
+
+		// update: a += P[:,0] v / f; then predict: a = T a
+		for i := range a {
+			a[i] += p[i*r] * v / f
+		}
+		a0 := a[0]
+		for i := 0; i < r-1; i++ {
+			a[i] = phi[i]*a0 + a[i+1]
+		}
+		a[r-1] = phi[r-1] * a0
+
+		if steady {
+			continue
+		}
+		// P = T (P - P[:,0] P[0,:] / f) T' + g g'
+		for i := 0; i < r; i++ {
+			for j := 0; j < r; j++ {
+				tmp[i*r+j] = p[i*r+j] - p[i*r]*p[j]/f
+			}
+		}
+		companionSandwich(phi, tmp, p, r)
+		for i := 0; i < r; i++ {
+			for j := 0; j < r; j++ {
+				p[i*r+j] += g[i] * g[j]
+			}
+		}
+		steady = math.Abs(p[0]-1) < 1e-9
+	}
+	n := float64(len(w))
+	sigma2 = ssq / n
+	return -0.5 * (n*math.Log(2*math.Pi*sigma2) + sumLogF + n), sigma2, nil
+}
+
+// companionSandwich sets dst to T src T', where T is the companion matrix with phi in its first
+// column and ones above its diagonal. Both are r×r, row major. It takes O(r²) instead of O(r³).
+func companionSandwich(phi, src, dst []float64, r int) {
+	// M = T src: M[i][j] = phi[i] src[0][j] + src[i+1][j]
+	m := make([]float64, r*r)
+	for i := 0; i < r; i++ {
+		for j := 0; j < r; j++ {
+			m[i*r+j] = phi[i] * src[j]
+			if i+1 < r {
+				m[i*r+j] += src[(i+1)*r+j]
+			}
+		}
+	}
+	// dst = M T': dst[i][j] = phi[j] M[i][0] + M[i][j+1]
+	for i := 0; i < r; i++ {
+		for j := 0; j < r; j++ {
+			dst[i*r+j] = phi[j] * m[i*r]
+			if j+1 < r {
+				dst[i*r+j] += m[i*r+j+1]
+			}
+		}
+	}
+}
+
+// stationaryCovariance solves P = T P T' + g g' for the covariance of the state, by doubling:
+// P = Σ Tᵏ g g' (Tᵏ)' is summed over twice as many powers of T at every iteration.
+func stationaryCovariance(phi, g []float64) ([]float64, error) {
+	r := len(phi)
+	t := mat.NewDense(r, r, nil)
+	for i := 0; i < r; i++ {
+		t.Set(i, 0, phi[i])
+		if i+1 < r {
+			t.Set(i, i+1, 1)
+		}
+	}
+	gv := mat.NewVecDense(r, g)
+	p := mat.NewDense(r, r, nil)
+	p.Outer(1, gv, gv)
+
+	var tp, tpt mat.Dense
+	for iter := 0; iter < 64; iter++ {
+		tp.Mul(t, p)
+		tpt.Mul(&tp, t.T())
+		p.Add(p, &tpt)
+		t.Mul(t, t)
+		if mat.Norm(&tpt, 1) < 1e-12*mat.Norm(p, 1) {
+			return p.RawMatrix().Data, nil
+		}
+	}
+	return nil, errors.New("The autoregression is too close to a unit root for the exact likelihood")
+}
+
+// fitARIMA fits the model of the given order to the series.
+func fitARIMA(y []float64, o arimaOrder, method arimaMethod) (*arima, error) {
+	return fitARIMAConditional(y, o, method, 0)
+}
+
+// fitARIMAConditional is fitARIMA with the CSS likelihood conditioned on the first cond
+// observations of the differenced series, or on as many as the autoregression needs if that is
+// more. Models conditioned on the same observations have CSS likelihoods of the same sample, so
+// their AICs can be compared.
+func fitARIMAConditional(y []float64, o arimaOrder, method arimaMethod, cond int) (*arima, error) {
+	if o.seasonal() && o.Period < 2 {
+		return nil, errors.Errorf("%v needs a period of at least 2", o)
+	}
+	if lags := o.P + o.SP*o.Period; cond < lags {
+		cond = lags
+	}
+	w := difference(y, o.D, o.SD, o.Period)
+	if len(w) <= cond+o.numParams()+1 {
+		return nil, errors.Errorf("The series of %d observations is too short for %v", len(y), o)
+	}
+
+	var mean float64
+	if o.hasMean() {
+		for _, v := range w {
+			mean += v / float64(len(w))
+		}
+	}
+	x0 := o.pack(make([]float64, o.P), make([]float64, o.Q), make([]float64, o.SP), make([]float64, o.SQ), mean)
+
+	demean := func(mean float64) []float64 {
+		if !o.hasMean() {
+			return w
+		}
+		retVal := make([]float64, len(w))
+		for i, v := range w {
+			retVal[i] = v - mean
+		}
+		return retVal
+	}
+	expanded := func(x []float64) (ar, ma []float64, mean float64) {
+		nar, nma, sar, sma, mean := o.unpack(x)
+		return expand(nar, sar, o.Period, -1), expand(nma, sma, o.Period, 1), mean
+	}
+	css := func(x []float64) float64 {
+		ar, ma, mean := expanded(x)
+		ll, _ := cssLogLik(demean(mean), ar, ma, cond)
+		return -ll
+	}
+	exact := func(x []float64) float64 {
+		ar, ma, mean := expanded(x)
+		ll, _, err := exactLogLik(demean(mean), ar, ma)
+		if err != nil || math.IsNaN(ll) {
+			return math.Inf(1)
+		}
+		return -ll
+	}
+
+	x := x0
+	var err error
+	if len(x0) > 0 {
+		if method == arimaCSS || method == arimaCSSML {
+			if x, err = minimize(css, x0); err != nil {
+				return nil, errors.Wrapf(err, "Unable to fit %v", o)
+			}
+		}
+		if method == arimaML || method == arimaCSSML {
+			if x, err = minimize(exact, x); err != nil {
+				return nil, errors.Wrapf(err, "Unable to fit %v", o)
+			}
+		}
+	}
+
+	a := &arima{arimaOrder: o, Method: method, y: y}
+	a.AR, a.MA, a.SAR, a.SMA, a.Mean = o.unpack(x)
+	a.ar, a.ma, _ = expanded(x)
+	if method == arimaCSS {
+		a.LogLik, a.Sigma2 = cssLogLik(demean(a.Mean), a.ar, a.ma, cond)
+	} else {
+		if a.LogLik, a.Sigma2, err = exactLogLik(demean(a.Mean), a.ar, a.ma); err != nil {
+			return nil, errors.Wrapf(err, "Unable to fit %v", o)
+		}
+	}
+	if math.IsNaN(a.LogLik) || math.IsInf(a.LogLik, 0) {
+		return nil, errors.Errorf("Unable to fit %v", o)
+	}
+	a.AIC = -2*a.LogLik + 2*float64(o.numParams()+1)
+	a.Residuals = append(make([]float64, o.lost()), cssResiduals(demean(a.Mean), a.ar, a.ma)...)
+	return a, nil
+}
+
+// minimize minimizes f with Nelder-Mead from x0.
+func minimize(f func([]float64) float64, x0 []float64) ([]float64, error) {
+	settings := optimize.DefaultSettingsLocal()
+	settings.FunctionConverge = &optimize.FunctionConverge{Absolute: 1e-8, Relative: 1e-8, Iterations: 100}
+	result, err := optimize.Minimize(optimize.Problem{Func: f}, x0, settings, &optimize.NelderMead{SimplexSize: 0.5})
+	if err != nil {
+		return nil, err
+	}
+	if math.IsInf(result.F, 1) {
+		return nil, errors.New("No parameters fit the series")
+	}
+	return result.X, nil
+}
+
+// autoARIMA chooses the order of the model for the series, in the manner of Hyndman and Khandakar
+// (2008): seasonal differencing if the seasonality is strong, then as many differences (up to two)
+// as the KPSS test needs to find the series stationary, and then the orders p, q ≤ 2 and
+// P, Q ≤ 1 with the lowest AIC. The orders are compared by their CSS fits, and the chosen order is
+// refitted with the method.
+func autoARIMA(y []float64, period int, method arimaMethod) (*arima, error) {
+	o := arimaOrder{Period: period}
+	if period > 1 && len(y) >= 3*period && seasonalStrength(y, period) > 0.64 {
+		o.SD = 1
+	}
+	x := difference(y, 0, o.SD, period)
+	for o.D < 2 && !kpss(x, -1, false).Stationary {
+		x = diff(x, 1)
+		o.D++
+	}
+
+	maxS := 0
+	if period > 1 {
+		maxS = 1
+	}
+	// every candidate is conditioned on the observations that the longest autoregression needs, so
+	// that their CSS likelihoods, and so their AICs, are of the same sample
+	cond := 2 + maxS*period
+	var best *arima
+	for p := 0; p <= 2; p++ {
+		for q := 0; q <= 2; q++ {
+			for sp := 0; sp <= maxS; sp++ {
+				for sq := 0; sq <= maxS; sq++ {
+					o.P, o.Q, o.SP, o.SQ = p, q, sp, sq
+					a, err := fitARIMAConditional(y, o, arimaCSS, cond)
+					if err != nil {
+						continue
+					}
+					if best == nil || a.AIC < best.AIC {
+						best = a
+					}
+				}
+			}
+		}
+	}
+	if best == nil {
+		return nil, errors.Errorf("No ARIMA model fits the series of %d observations", len(y))
+	}
+	return fitARIMA(y, best.arimaOrder, method)
+}
+
+// integrated returns the AR coefficients of the model of the undifferenced series: the
+// autoregression multiplied by (1 - B)ᵈ(1 - Bᵐ)ᴰ.
+func (a *arima) integrated() []float64 {
+	poly := make([]float64, len(a.ar)+1)
+	poly[0] = 1
+	for i, c := range a.ar {
+		poly[i+1] = -c
+	}
+	for i := 0; i < a.D; i++ {
+		poly = polyMul(poly, []float64{1, -1})
+	}
+	for i := 0; i < a.SD; i++ {
+		seasonal := make([]float64, a.Period+1)
+		seasonal[0], seasonal[a.Period] = 1, -1
+		poly = polyMul(poly, seasonal)
+	}
+	retVal := make([]float64, len(poly)-1)
+	for i := range retVal {
+		retVal[i] = -poly[i+1]
+	}
+	return retVal
+}
+
+// Forecast forecasts the series h steps ahead of its end.
+func (a *arima) Forecast(h int) []float64 {
+	phi := a.integrated()
+	n := len(a.y)
+	y := make([]float64, n+h)
+	for t, v := range a.y {
+		y[t] = v - a.Mean
+	}
+	for t := n; t < n+h; t++ {
+		var f float64
+		for i, c := range phi {
+			if t-1-i >= 0 {
+				f += c * y[t-1-i]
+			}
+		}
+		for j, b := range a.ma {
+			if s := t - 1 - j; s < n && s >= 0 {
+				f += b * a.Residuals[s]
+			}
+		}
+		y[t] = f
+	}
+	retVal := y[n:]
+	for i := range retVal {
+		retVal[i] += a.Mean
+	}
+	return retVal
+}
+
+// Predict forecasts the series h steps ahead of its end, with prediction intervals from the ψ
+// weights of the model: the variance h steps ahead is σ²(ψ₀² + ... + ψₕ₋₁²).
+func (a *arima) Predict(h int) prediction {
+	point := a.Forecast(h)
+	phi := a.integrated()
+	psi := make([]float64, h)
+	variances := make([]float64, h)
+	var sum float64
+	for j := 0; j < h; j++ {
+		if j == 0 {
+			psi[0] = 1
+		} else {
+			if j-1 < len(a.ma) {
+				psi[j] = a.ma[j-1]
+			}
+			for i := 1; i <= j && i <= len(phi); i++ {
+				psi[j] += phi[i-1] * psi[j-i]
+			}
+		}
+		sum += psi[j] * psi[j]
+		variances[j] = a.Sigma2 * sum
+	}
+	return prediction{point, normalIntervals(point, variances)}
+}
+
+func (a *arima) String() string {
+	s := a.arimaOrder.String()
+	for _, c := range []struct {
+		name  string
+		coefs []float64
+	}{{"ar", a.AR}, {"ma", a.MA}, {"sar", a.SAR}, {"sma", a.SMA}} {
+		for i, v := range c.coefs {
+			s += fmt.Sprintf(" %s%d=%.6f", c.name, i+1, v)
+		}
+	}
+	if a.hasMean() {
+		s += fmt.Sprintf(" mean=%.6f", a.Mean)
+	}
+	return s + fmt.Sprintf(" sigma2=%.6g AIC=%.2f (%s)", a.Sigma2, a.AIC, a.Method)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// simulateARMA simulates n observations of the ARMA(1,1) process y[t] = φy[t-1] + e[t] + θe[t-1].
+func simulateARMA(n int, phi, theta float64, seed int64) []float64 {
+	r := rand.New(rand.NewSource(seed))
+	y := make([]float64, n)
+	var prevE float64
+	for t := range y {
+		e := r.NormFloat64()
+		if t > 0 {
+			y[t] = phi * y[t-1]
+		}
+		y[t] += e + theta*prevE
+		prevE = e
+	}
+	return y
+}
+
+func TestPartrans(t *testing.T) {
+	u := []float64{0.3, -1.2, 0.8}
+	got := invPartrans(partrans(u))
+	for i := range u {
+		if math.Abs(got[i]-u[i]) > 1e-9 {
+			t.Errorf("Expected invPartrans to invert partrans. Got %v for %v", got, u)
+			break
+		}
+	}
+}
+
+func TestFitARIMA(t *testing.T) {
+	y := simulateARMA(2000, 0.6, 0.3, 1)
+	for _, method := range []arimaMethod{arimaCSS, arimaML, arimaCSSML} {
+		a, err := fitARIMA(y, arimaOrder{P: 1, Q: 1}, method)
+		if err != nil {
+			t.Errorf("%v: %v", method, err)
+			continue
+		}
+		if math.Abs(a.AR[0]-0.6) > 0.1 || math.Abs(a.MA[0]-0.3) > 0.1 || math.Abs(a.Sigma2-1) > 0.1 {
+			t.Errorf("%v: expected ar1 ≈ 0.6, ma1 ≈ 0.3 and sigma2 ≈ 1. Got %v", method, a)
+		}
+	}
+
+	// white noise conditioned on its first five observations has the likelihood of the rest
+	cond, err := fitARIMAConditional(y, arimaOrder{}, arimaCSS, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest := y[5:]
+	var mean, sigma2 float64
+	for _, v := range rest {
+		mean += v / float64(len(rest))
+	}
+	for _, v := range rest {
+		sigma2 += (v - mean) * (v - mean) / float64(len(rest))
+	}
+	if ll := -0.5 * float64(len(rest)) * (math.Log(2*math.Pi*sigma2) + 1); math.Abs(cond.LogLik-ll) > 1e-3 {
+		t.Errorf("Expected the log likelihood %v of the last %d observations. Got %v", ll, len(rest), cond.LogLik)
+	}
+
+	// a random walk is differenced once, and forecast flat with growing intervals
+	walk := make([]float64, len(y))
+	for i := 1; i < len(y); i++ {
+		walk[i] = walk[i-1] + y[i]
+	}
+	a, err := autoARIMA(walk, 1, arimaCSS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.D != 1 {
+		t.Errorf("Expected the random walk to be differenced once. Got %v", a)
+	}
+	pred := a.Predict(12)
+	in := pred.Intervals[1]
+	if in.Upper[11]-in.Lower[11] <= in.Upper[0]-in.Lower[0] {
+		t.Errorf("Expected the intervals of %v to widen with the horizon", a)
+	}
+}
+
+func TestStationarity(t *testing.T) {
+	noise := simulateARMA(500, 0, 0, 2)
+	walk := make([]float64, len(noise))
+	for i := 1; i < len(noise); i++ {
+		walk[i] = walk[i-1] + noise[i]
+	}
+
+	for _, tc := range []struct {
+		name       string
+		y          []float64
+		stationary bool
+	}{{"noise", noise, true}, {"random walk", walk, false}} {
+		test, err := adf(tc.y, -1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.Stationary != tc.stationary {
+			t.Errorf("%s: unexpected %v", tc.name, test)
+		}
+		if test := kpss(tc.y, -1, false); test.Stationary != tc.stationary {
+			t.Errorf("%s: unexpected %v", tc.name, test)
+		}
+	}
+
+	if got := difference([]float64{1, 2, 4, 7, 11, 16}, 1, 1, 2); len(got) != 3 || got[0] != 2 || got[2] != 2 {
+		t.Errorf("Expected the differences [2 2 2]. Got %v", got)
+	}
+}
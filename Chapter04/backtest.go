@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+
+	"github.com/chewxy/stl"
+	"github.com/pkg/errors"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+)
+
+// forecaster is a forecasting model that can be fitted to a series.
+type forecaster interface {
+	Fit(y []float64) (fittedModel, error)
+}
+
+// fittedModel is a model fitted to a series, which forecasts the series h steps ahead of its end.
+type fittedModel interface {
+	Forecast(h int) []float64
+}
+
+// hwForecaster is hw on the STL decomposition of the series, with the smoothing parameters
+// fitted to the series if Optimize is set.
+type hwForecaster struct {
+	Period, Width int
+	Params        hwParams
+	Optimize      bool
+}
+
+// hwModel is hw fitted to a series.
+type hwModel struct {
+	a      stl.Result
+	period int
+	p      hwParams
+}
+
+func (f hwForecaster) Fit(y []float64) (fittedModel, error) {
+	decomposed := stl.Decompose(y, f.Period, f.Width, stl.Additive(), stl.WithIter(1))
+	if decomposed.Err != nil {
+		return nil, decomposed.Err
+	}
+	p := f.Params
+	if f.Optimize {
+		fitted, err := fitHW(decomposed, f.Period, 1, p)
+		if err != nil {
+			return nil, err
+		}
+		p = fitted.hwParams
+	}
+	return hwModel{decomposed, f.Period, p}, nil
+}
+
+func (m hwModel) Forecast(h int) []float64 { return hwForecast(m.a, m.period, h, m.p) }
+
+// etsForecaster fits the named ETS model, or chooses one by AIC if the name is "auto".
+type etsForecaster struct {
+	Period int
+	Model  string
+}
+
+func (f etsForecaster) Fit(y []float64) (fittedModel, error) { return newETS(y, f.Period, f.Model) }
+
+// arimaForecaster fits the ARIMA model of the given order, or chooses an order by AIC if the order
+// is "auto".
+type arimaForecaster struct {
+	Period int
+	Order  string
+	Method arimaMethod
+}
+
+func (f arimaForecaster) Fit(y []float64) (fittedModel, error) {
+	return newARIMA(y, f.Period, f.Order, f.Method)
+}
+
+// backtest evaluates forecasters by rolling the forecast origin through a series: the model is
+// fitted to the series up to the origin and forecasts Horizon steps ahead, and the origin moves
+// on by Step.
+type backtest struct {
+	Initial int  // the number of observations before the first origin
+	Horizon int  // the number of steps forecasted from every origin
+	Step    int  // the number of steps between origins
+	Sliding bool // fit to the last Initial observations only, instead of all of them
+	Period  int  // the period of the seasonal naive forecasts that scale MASE
+}
+
+// accuracy holds the errors of the forecasts of a backtest at every horizon: the mean absolute
+// error, the root mean squared error, the mean absolute percentage error, the symmetric MAPE
+// and the mean absolute scaled error. The percentages are out of 100. The errors that are undefined
+// at an origin, the percentages where the actual value is zero and MASE where the series is
+// constant, leave it out of their means, which are NaN if it leaves no origins.
+type accuracy struct {
+	MAE, RMSE, MAPE, SMAPE, MASE []float64
+	Origins                      int
+}
+
+// metrics lists the errors of accuracy, in order.
+var metrics = []string{"MAE", "RMSE", "MAPE", "sMAPE", "MASE"}
+
+func (acc accuracy) metric(i int) []float64 {
+	return [][]float64{acc.MAE, acc.RMSE, acc.MAPE, acc.SMAPE, acc.MASE}[i]
+}
+
+// Run backtests the forecaster on the series.
+func (b backtest) Run(f forecaster, y []float64) (accuracy, error) {
+	step := b.Step
+	if step <= 0 {
+		step = 1
+	}
+	period := b.Period
+	if period <= 0 {
+		period = 1
+	}
+	if b.Initial <= period || b.Horizon <= 0 || b.Initial+b.Horizon > len(y) {
+		return accuracy{}, errors.Errorf("Unable to backtest %d steps ahead after %d of %d observations", b.Horizon, b.Initial, len(y))
+	}
+
+	acc := accuracy{
+		MAE:   make([]float64, b.Horizon),
+		RMSE:  make([]float64, b.Horizon),
+		MAPE:  make([]float64, b.Horizon),
+		SMAPE: make([]float64, b.Horizon),
+		MASE:  make([]float64, b.Horizon),
+	}
+	// the number of origins every percentage and MASE is the mean of
+	nPct := make([]int, b.Horizon)
+	nSMAPE := make([]int, b.Horizon)
+	nMASE := make([]int, b.Horizon)
+	for origin := b.Initial; origin+b.Horizon <= len(y); origin += step {
+		start := 0
+		if b.Sliding {
+			start = origin - b.Initial
+		}
+		train := y[start:origin]
+		model, err := f.Fit(train)
+		if err != nil {
+			return acc, errors.Wrapf(err, "Backtest at origin %d", origin)
+		}
+		forecast := model.Forecast(b.Horizon)
+
+		// the in-sample mean absolute error of the seasonal naive forecasts
+		var scale float64
+		for t := period; t < len(train); t++ {
+			scale += math.Abs(train[t]-train[t-period]) / float64(len(train)-period)
+		}
+		for h, f := range forecast {
+			actual := y[origin+h]
+			e := actual - f
+			acc.MAE[h] += math.Abs(e)
+			acc.RMSE[h] += e * e
+			if actual != 0 {
+				acc.MAPE[h] += 100 * math.Abs(e/actual)
+				nPct[h]++
+			}
+			if d := math.Abs(actual) + math.Abs(f); d != 0 {
+				acc.SMAPE[h] += 200 * math.Abs(e) / d
+				nSMAPE[h]++
+			}
+			if scale != 0 {
+				acc.MASE[h] += math.Abs(e) / scale
+				nMASE[h]++
+			}
+		}
+		acc.Origins++
+	}
+
+	n := float64(acc.Origins)
+	for h := 0; h < b.Horizon; h++ {
+		acc.MAE[h] /= n
+		acc.RMSE[h] = math.Sqrt(acc.RMSE[h] / n)
+		acc.MAPE[h] = mean(acc.MAPE[h], nPct[h])
+		acc.SMAPE[h] = mean(acc.SMAPE[h], nSMAPE[h])
+		acc.MASE[h] = mean(acc.MASE[h], nMASE[h])
+	}
+	return acc, nil
+}
+
+// mean is the mean of n values that sum to sum, or NaN if there are none.
+func mean(sum float64, n int) float64 {
+	if n == 0 {
+		return math.NaN()
+	}
+	return sum / float64(n)
+}
+
+// writeAccuracy writes a table of the errors of every model at every horizon.
+func writeAccuracy(w io.Writer, names []string, accs []accuracy) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "model\th\t")
+	for _, m := range metrics {
+		fmt.Fprintf(tw, "%s\t", m)
+	}
+	fmt.Fprintln(tw)
+	for i, acc := range accs {
+		for h := range acc.MAE {
+			fmt.Fprintf(tw, "%s\t%d\t", names[i], h+1)
+			for m := range metrics {
+				fmt.Fprintf(tw, "%.4f\t", acc.metric(m)[h])
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+	return tw.Flush()
+}
+
+// plotAccuracy plots every error against the horizon, with a line for every model.
+func plotAccuracy(names []string, accs []accuracy) [][]*plot.Plot {
+	plots := make([][]*plot.Plot, len(metrics))
+	for m, metric := range metrics {
+		p, err := plot.New()
+		dieIfErr(err)
+		var lines []interface{}
+		for i, acc := range accs {
+			var xys plotter.XYs
+			for h, v := range acc.metric(m) {
+				if math.IsNaN(v) {
+					continue // undefined at every origin
+				}
+				xys = append(xys, struct{ X, Y float64 }{float64(h + 1), v})
+			}
+			lines = append(lines, names[i], xys)
+		}
+		dieIfErr(plotutil.AddLinePoints(p, lines...))
+		p.X.Label.Text = "Horizon"
+		p.Y.Label.Text = metric
+		p.Legend.TextStyle.Font = defaultFont
+		p.Y.Label.TextStyle.Font = defaultFont
+		p.X.Label.TextStyle.Font = defaultFont
+		p.X.Tick.Label.Font = defaultFont
+		p.Y.Tick.Label.Font = defaultFont
+		p.Title.Font = defaultFont
+		p.Title.Font.Size = 16
+		plots[m] = []*plot.Plot{p}
+	}
+	return plots
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// lastValue forecasts the last observation, and records the length of the series it was fitted to.
+type lastValue struct{ fitted *[]int }
+
+func (f lastValue) Fit(y []float64) (fittedModel, error) {
+	*f.fitted = append(*f.fitted, len(y))
+	return lastValueModel(y[len(y)-1]), nil
+}
+
+type lastValueModel float64
+
+func (m lastValueModel) Forecast(h int) []float64 {
+	retVal := make([]float64, h)
+	for i := range retVal {
+		retVal[i] = float64(m)
+	}
+	return retVal
+}
+
+func TestBacktest(t *testing.T) {
+	// on a line rising by 1, forecasting the last value is off by h at horizon h
+	y := make([]float64, 30)
+	for i := range y {
+		y[i] = float64(i + 1)
+	}
+
+	var lengths []int
+	acc, err := backtest{Initial: 10, Horizon: 3, Step: 5, Period: 1}.Run(lastValue{&lengths}, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc.Origins != 4 || len(lengths) != 4 || lengths[3] != 25 {
+		t.Errorf("Expected origins at 10, 15, 20 and 25 of an expanding window. Got %d, fitted to %v", acc.Origins, lengths)
+	}
+	for h := 0; h < 3; h++ {
+		e := float64(h + 1)
+		if math.Abs(acc.MAE[h]-e) > 1e-9 || math.Abs(acc.RMSE[h]-e) > 1e-9 || math.Abs(acc.MASE[h]-e) > 1e-9 {
+			t.Errorf("Expected MAE, RMSE and MASE of %v at horizon %d. Got %v, %v and %v", e, h+1, acc.MAE[h], acc.RMSE[h], acc.MASE[h])
+		}
+		var mape float64
+		for _, origin := range []int{10, 15, 20, 25} {
+			mape += 100 * e / y[origin+h] / 4
+		}
+		if math.Abs(acc.MAPE[h]-mape) > 1e-9 {
+			t.Errorf("Expected MAPE %v at horizon %d. Got %v", mape, h+1, acc.MAPE[h])
+		}
+	}
+
+	// MAPE leaves out the origin that forecasts a zero, and a constant series has no MASE
+	for i := range y {
+		y[i] = float64(i - 15)
+	}
+	acc, err = backtest{Initial: 10, Horizon: 1, Step: 5, Period: 1}.Run(lastValue{&lengths}, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mape := 100 * (1/5.0 + 1/5.0 + 1/10.0) / 3; math.Abs(acc.MAPE[0]-mape) > 1e-9 {
+		t.Errorf("Expected MAPE %v without the zero. Got %v", mape, acc.MAPE[0])
+	}
+	acc, err = backtest{Initial: 10, Horizon: 1, Step: 5, Period: 1}.Run(lastValue{&lengths}, make([]float64, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc.MAE[0] != 0 || !math.IsNaN(acc.MAPE[0]) || !math.IsNaN(acc.SMAPE[0]) || !math.IsNaN(acc.MASE[0]) {
+		t.Errorf("Expected no error, and undefined percentages and MASE, on a series of zeros. Got %v", acc)
+	}
+
+	lengths = nil
+	if _, err := (backtest{Initial: 10, Horizon: 3, Step: 5, Sliding: true}).Run(lastValue{&lengths}, y); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range lengths {
+		if n != 10 {
+			t.Errorf("Expected a sliding window of 10 observations. Got windows of %v", lengths)
+			break
+		}
+	}
+
+	if _, err := (backtest{Initial: 28, Horizon: 3}).Run(lastValue{&lengths}, y); err == nil {
+		t.Errorf("Expected an error when the series is too short")
+	}
+}
+
+func TestHWModelForecast(t *testing.T) {
+	y := seasonalSeries(120, 1)
+	fitted, err := hwForecaster{Period: 12, Width: 84, Params: hwParams{0.2, 0.05, 0.1}}.Fit(y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := fitted.(hwModel)
+	level, trend, seasonal := hwSmooth(m.a, 12, m.p)
+	n := len(y)
+	oneStep := level[n-1] + trend[n-1] + seasonal[n-12]
+	for _, h := range []int{1, 3, 24} {
+		if got := m.Forecast(h)[0]; math.Abs(got-oneStep) > 1e-9 {
+			t.Errorf("Expected the first of %d forecasts to be the one-step forecast %v. Got %v", h, oneStep, got)
+		}
+	}
+}
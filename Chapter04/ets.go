@@ -0,0 +1,482 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/optimize"
+)
+
+// etsComponent is the form of a component of an ETS model.
+type etsComponent byte
+
+const (
+	etsNone           etsComponent = 'N'
+	etsAdditive       etsComponent = 'A'
+	etsMultiplicative etsComponent = 'M'
+	etsDamped         etsComponent = 'd' // an additive damped trend
+)
+
+// etsModel is an exponential smoothing state space model in the taxonomy of Hyndman et al.
+// (2008), "Forecasting with Exponential Smoothing": the error is additive or multiplicative, the
+// trend none, additive or additive damped, and the seasonality none, additive or multiplicative.
+type etsModel struct {
+	Error, Trend, Season etsComponent
+}
+
+// etsModels lists every model autoETS chooses from. Additive errors with multiplicative
+// seasonality are left out, as they are numerically unstable.
+var etsModels = func() (retVal []etsModel) {
+	for _, e := range []etsComponent{etsAdditive, etsMultiplicative} {
+		for _, t := range []etsComponent{etsNone, etsAdditive, etsDamped} {
+			for _, s := range []etsComponent{etsNone, etsAdditive, etsMultiplicative} {
+				if e == etsAdditive && s == etsMultiplicative {
+					continue
+				}
+				retVal = append(retVal, etsModel{e, t, s})
+			}
+		}
+	}
+	return
+}()
+
+// parseETSModel parses a model in the notation of Hyndman et al., without the commas: "ANN" is
+// simple exponential smoothing, "AAdN" the additive damped trend method, "MAM" multiplicative
+// Holt-Winters, and so on.
+func parseETSModel(s string) (etsModel, error) {
+	if len(s) < 3 || len(s) > 4 {
+		return etsModel{}, errors.Errorf("Unable to parse ETS model %q. Expected an error, trend and season, like \"AAdM\"", s)
+	}
+	m := etsModel{etsComponent(s[0]), etsComponent(s[1]), etsComponent(s[len(s)-1])}
+	if len(s) == 4 {
+		if s[1:3] != "Ad" {
+			return etsModel{}, errors.Errorf("Unable to parse ETS model %q. Expected the damped trend to be \"Ad\"", s)
+		}
+		m.Trend = etsDamped
+	}
+	switch {
+	case m.Error != etsAdditive && m.Error != etsMultiplicative:
+		return etsModel{}, errors.Errorf("Unable to parse ETS model %q. Expected the error to be A or M", s)
+	case m.Trend != etsNone && m.Trend != etsAdditive && m.Trend != etsDamped:
+		return etsModel{}, errors.Errorf("Unable to parse ETS model %q. Expected the trend to be N, A or Ad", s)
+	case m.Season != etsNone && m.Season != etsAdditive && m.Season != etsMultiplicative:
+		return etsModel{}, errors.Errorf("Unable to parse ETS model %q. Expected the season to be N, A or M", s)
+	}
+	return m, nil
+}
+
+func (m etsModel) String() string {
+	trend := string(m.Trend)
+	if m.Trend == etsDamped {
+		trend = "Ad"
+	}
+	return fmt.Sprintf("ETS(%c,%s,%c)", m.Error, trend, m.Season)
+}
+
+// multiplicative reports whether the model has a multiplicative component, which requires the
+// series to be positive.
+func (m etsModel) multiplicative() bool {
+	return m.Error == etsMultiplicative || m.Season == etsMultiplicative
+}
+
+// damp is the multiplier of the trend h steps ahead: φ + φ² + ... + φʰ for a damped trend, h for
+// an additive trend and 0 without a trend.
+func (m etsModel) damp(phi float64, h int) (retVal float64) {
+	switch m.Trend {
+	case etsNone:
+		return 0
+	case etsAdditive:
+		return float64(h)
+	}
+	pow := 1.0
+	for i := 0; i < h; i++ {
+		pow *= phi
+		retVal += pow
+	}
+	return
+}
+
+// etsParams are the smoothing parameters of an ETS model, in the Holt-Winters form: Beta is the
+// smoothing of the trend (β* in Hyndman et al.), and Phi the damping of the trend.
+type etsParams struct {
+	Alpha, Beta, Gamma, Phi float64
+}
+
+// etsState holds the level, the trend and the seasonal components of an ETS model. The seasonal
+// component of time t is Season[t%len(Season)].
+type etsState struct {
+	Level, Trend float64
+	Season       []float64
+}
+
+// ets is an ETS model fitted to a series.
+type ets struct {
+	etsModel
+	etsParams
+	Period int
+
+	Sigma2 float64 // the variance of the residuals
+	LogLik float64
+	AIC    float64
+
+	Fitted    []float64 // the one-step-ahead forecasts of the series
+	Residuals []float64 // the one-step-ahead errors; relative to the forecast if the error is multiplicative
+
+	init, final etsState
+	n           int
+}
+
+// filter runs the model over the series from the initial state. It returns the final state, the
+// one-step-ahead forecasts and the errors, or false if the forecasts or the states went out of
+// the range of the model.
+func (m etsModel) filter(y []float64, p etsParams, init etsState) (st etsState, fitted, errs []float64, ok bool) {
+	st = init.clone()
+	fitted = make([]float64, len(y))
+	errs = make([]float64, len(y))
+	for t, yt := range y {
+		mu, lb, season, ok := m.predict(st, t, p.Phi)
+		if !ok {
+			return st, fitted, errs, false
+		}
+		fitted[t] = mu
+		errs[t] = yt - mu
+		if m.Error == etsMultiplicative {
+			errs[t] /= mu
+		}
+		m.update(&st, t, yt, lb, season, p)
+	}
+	return st, fitted, errs, true
+}
+
+// predict returns the one-step-ahead forecast mu of time t from the state, along with the level
+// and trend lb and the seasonal component it was made of. It returns false if the forecast is out
+// of the range of the model.
+func (m etsModel) predict(st etsState, t int, phi float64) (mu, lb, season float64, ok bool) {
+	lb = st.Level + m.damp(phi, 1)*st.Trend
+	mu = lb
+	switch m.Season {
+	case etsAdditive:
+		season = st.Season[t%len(st.Season)]
+		mu = lb + season
+	case etsMultiplicative:
+		season = st.Season[t%len(st.Season)]
+		if season <= 0 || lb <= 0 {
+			return mu, lb, season, false
+		}
+		mu = lb * season
+	}
+	if m.Error == etsMultiplicative && mu <= 0 {
+		return mu, lb, season, false
+	}
+	return mu, lb, season, true
+}
+
+// update updates the state with the observation yt of time t.
+func (m etsModel) update(st *etsState, t int, yt, lb, season float64, p etsParams) {
+	var level float64
+	switch m.Season {
+	case etsNone:
+		level = p.Alpha*yt + (1-p.Alpha)*lb
+	case etsAdditive:
+		level = p.Alpha*(yt-season) + (1-p.Alpha)*lb
+	case etsMultiplicative:
+		level = p.Alpha*yt/season + (1-p.Alpha)*lb
+	}
+	if m.Trend != etsNone {
+		st.Trend = p.Beta*(level-st.Level) + (1-p.Beta)*(lb-st.Level)
+	}
+	switch m.Season {
+	case etsAdditive:
+		st.Season[t%len(st.Season)] = p.Gamma*(yt-lb) + (1-p.Gamma)*season
+	case etsMultiplicative:
+		st.Season[t%len(st.Season)] = p.Gamma*yt/lb + (1-p.Gamma)*season
+	}
+	st.Level = level
+}
+
+func (st etsState) clone() etsState {
+	return etsState{st.Level, st.Trend, append([]float64(nil), st.Season...)}
+}
+
+// initState is the heuristic initial state of Hyndman et al.: the seasonal components are the
+// averages of each season of the first few cycles, detrended by a centred moving average, and the
+// level and trend come from a linear regression on the first ten deseasonalised observations.
+func (m etsModel) initState(y []float64, period int) (etsState, error) {
+	st := etsState{Season: make([]float64, period)}
+	deseasonalized := append([]float64(nil), y...)
+	if m.Season != etsNone {
+		if period < 2 {
+			return st, errors.Errorf("%v needs a period of at least 2. Got %d", m, period)
+		}
+		if len(y) < 2*period {
+			return st, errors.Errorf("%v needs at least two cycles of data. Got %d observations for a period of %d", m, len(y), period)
+		}
+		cycles := len(y) / period
+		if cycles > 4 {
+			cycles = 4
+		}
+		ma := centredMovingAverage(y[:cycles*period], period)
+		var sums, counts = make([]float64, period), make([]float64, period)
+		for t, avg := range ma {
+			if math.IsNaN(avg) {
+				continue
+			}
+			if m.Season == etsMultiplicative {
+				sums[t%period] += y[t] / avg
+			} else {
+				sums[t%period] += y[t] - avg
+			}
+			counts[t%period]++
+		}
+		var total float64
+		for i := range st.Season {
+			st.Season[i] = sums[i] / counts[i]
+			total += st.Season[i]
+		}
+		// normalize the seasonal components to sum to 0, or average 1
+		for i := range st.Season {
+			if m.Season == etsMultiplicative {
+				st.Season[i] /= total / float64(period)
+				deseasonalized[i] = y[i] / st.Season[i]
+			} else {
+				st.Season[i] -= total / float64(period)
+				deseasonalized[i] = y[i] - st.Season[i]
+			}
+		}
+		for t := period; t < len(y); t++ {
+			if m.Season == etsMultiplicative {
+				deseasonalized[t] = y[t] / st.Season[t%period]
+			} else {
+				deseasonalized[t] = y[t] - st.Season[t%period]
+			}
+		}
+	}
+
+	k := 10
+	if len(y) < k {
+		k = len(y)
+	}
+	if k < 2 {
+		return st, errors.Errorf("%v needs at least two observations. Got %d", m, len(y))
+	}
+	if m.Trend == etsNone {
+		for _, v := range deseasonalized[:k] {
+			st.Level += v
+		}
+		st.Level /= float64(k)
+		return st, nil
+	}
+	// least squares of the observations against t = 1..k; the level is the intercept at t = 0
+	var sx, sy, sxx, sxy float64
+	for i, v := range deseasonalized[:k] {
+		x := float64(i + 1)
+		sx += x
+		sy += v
+		sxx += x * x
+		sxy += x * v
+	}
+	n := float64(k)
+	st.Trend = (n*sxy - sx*sy) / (n*sxx - sx*sx)
+	st.Level = (sy - st.Trend*sx) / n
+	return st, nil
+}
+
+// centredMovingAverage is the centred moving average of the given order, a 2×order moving
+// average if the order is even. It is NaN where the window does not fit the series.
+func centredMovingAverage(y []float64, order int) []float64 {
+	retVal := make([]float64, len(y))
+	half := order / 2
+	for t := range y {
+		if t-half < 0 || t+half >= len(y) {
+			retVal[t] = math.NaN()
+			continue
+		}
+		var sum float64
+		if order%2 == 0 {
+			sum = (y[t-half] + y[t+half]) / 2
+			for j := t - half + 1; j < t+half; j++ {
+				sum += y[j]
+			}
+		} else {
+			for j := t - half; j <= t+half; j++ {
+				sum += y[j]
+			}
+		}
+		retVal[t] = sum / float64(order)
+	}
+	return retVal
+}
+
+// the bounds of the smoothing parameters and of the damping of the trend
+const (
+	minSmoothing, maxSmoothing = 1e-4, 1 - 1e-4
+	minDamping, maxDamping     = 0.8, 0.98
+)
+
+// bounded maps x onto (lo, hi), so the parameters can be optimized without bounds.
+func bounded(x, lo, hi float64) float64 { return lo + (hi-lo)*sigmoid(x) }
+
+// unbounded is the inverse of bounded.
+func unbounded(v, lo, hi float64) float64 { return logit((v - lo) / (hi - lo)) }
+
+// fitETS fits the smoothing parameters of the model to the series by maximum likelihood, from the
+// heuristic initial state. The parameters are kept in the usual region: α and β* in (0, 1), γ in
+// (0, 1-α) and φ in (0.8, 0.98).
+func fitETS(y []float64, period int, m etsModel) (*ets, error) {
+	if m.multiplicative() {
+		for _, v := range y {
+			if v <= 0 {
+				return nil, errors.Errorf("%v needs a positive series", m)
+			}
+		}
+	}
+	init, err := m.initState(y, period)
+	if err != nil {
+		return nil, err
+	}
+
+	params := func(x []float64) (p etsParams) {
+		p.Alpha = bounded(x[0], minSmoothing, maxSmoothing)
+		x = x[1:]
+		if m.Trend != etsNone {
+			p.Beta = bounded(x[0], minSmoothing, maxSmoothing)
+			x = x[1:]
+		}
+		if m.Season != etsNone {
+			p.Gamma = (1 - p.Alpha) * bounded(x[0], minSmoothing, maxSmoothing)
+			x = x[1:]
+		}
+		p.Phi = 1
+		if m.Trend == etsDamped {
+			p.Phi = bounded(x[0], minDamping, maxDamping)
+		}
+		return
+	}
+	x0 := []float64{unbounded(0.3, minSmoothing, maxSmoothing)}
+	if m.Trend != etsNone {
+		x0 = append(x0, unbounded(0.1, minSmoothing, maxSmoothing))
+	}
+	if m.Season != etsNone {
+		x0 = append(x0, unbounded(0.1, minSmoothing, maxSmoothing))
+	}
+	if m.Trend == etsDamped {
+		x0 = append(x0, unbounded(0.9, minDamping, maxDamping))
+	}
+
+	problem := optimize.Problem{
+		Func: func(x []float64) float64 {
+			_, fitted, errs, ok := m.filter(y, params(x), init)
+			if !ok {
+				return math.Inf(1)
+			}
+			ll := m.logLik(fitted, errs)
+			if math.IsNaN(ll) {
+				return math.Inf(1)
+			}
+			return -ll
+		},
+	}
+	settings := optimize.DefaultSettingsLocal()
+	settings.FunctionConverge = &optimize.FunctionConverge{Absolute: 1e-10, Relative: 1e-10, Iterations: 100}
+	result, err := optimize.Minimize(problem, x0, settings, &optimize.NelderMead{SimplexSize: 1})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to fit %v", m)
+	}
+	if math.IsInf(result.F, 1) {
+		return nil, errors.Errorf("Unable to fit %v: the model does not fit the range of the series", m)
+	}
+
+	e := &ets{etsModel: m, etsParams: params(result.X), Period: period, init: init, n: len(y)}
+	e.final, e.Fitted, e.Residuals, _ = m.filter(y, e.etsParams, init)
+	for _, r := range e.Residuals {
+		e.Sigma2 += r * r
+	}
+	e.Sigma2 /= float64(len(y))
+	e.LogLik = m.logLik(e.Fitted, e.Residuals)
+	e.AIC = -2*e.LogLik + 2*float64(e.numParams()+1)
+	return e, nil
+}
+
+// logLik is the Gaussian log likelihood of the model, with the variance of the errors
+// concentrated out.
+func (m etsModel) logLik(fitted, errs []float64) float64 {
+	var sse, logMu float64
+	for i, e := range errs {
+		sse += e * e
+		if m.Error == etsMultiplicative {
+			logMu += math.Log(math.Abs(fitted[i]))
+		}
+	}
+	n := float64(len(errs))
+	return -0.5*n*(math.Log(2*math.Pi*sse/n)+1) - logMu
+}
+
+// numParams is the number of parameters of the fitted model: the smoothing parameters and the
+// initial states.
+func (e *ets) numParams() int {
+	k := 2 // α and the level
+	if e.Trend != etsNone {
+		k += 2
+	}
+	if e.Trend == etsDamped {
+		k++
+	}
+	if e.Season != etsNone {
+		k += e.Period // γ and all but one of the seasonal components
+	}
+	return k
+}
+
+// autoETS fits every model in etsModels that suits the series, and returns the one with the
+// lowest AIC.
+func autoETS(y []float64, period int) (best *ets, err error) {
+	var errs []string
+	for _, m := range etsModels {
+		if m.Season != etsNone && (period < 2 || len(y) < 2*period) {
+			continue
+		}
+		e, err := fitETS(y, period, m)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if best == nil || e.AIC < best.AIC {
+			best = e
+		}
+	}
+	if best == nil {
+		return nil, errors.Errorf("No ETS model fits the series: %v", errs)
+	}
+	return best, nil
+}
+
+// Forecast forecasts the series h steps ahead of its end.
+func (e *ets) Forecast(h int) []float64 {
+	retVal := make([]float64, h)
+	for i := 1; i <= h; i++ {
+		f := e.final.Level + e.damp(e.Phi, i)*e.final.Trend
+		switch e.Season {
+		case etsAdditive:
+			f += e.final.Season[(e.n+i-1)%e.Period]
+		case etsMultiplicative:
+			f *= e.final.Season[(e.n+i-1)%e.Period]
+		}
+		retVal[i-1] = f
+	}
+	return retVal
+}
+
+func (e *ets) String() string {
+	s := fmt.Sprintf("%v alpha=%.6f", e.etsModel, e.Alpha)
+	if e.Trend != etsNone {
+		s += fmt.Sprintf(" beta=%.6f", e.Beta)
+	}
+	if e.Season != etsNone {
+		s += fmt.Sprintf(" gamma=%.6f", e.Gamma)
+	}
+	if e.Trend == etsDamped {
+		s += fmt.Sprintf(" phi=%.6f", e.Phi)
+	}
+	return s + fmt.Sprintf(" sigma2=%.6g AIC=%.2f", e.Sigma2, e.AIC)
+}
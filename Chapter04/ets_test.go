@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseETSModel(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want etsModel
+	}{
+		{"ANN", etsModel{etsAdditive, etsNone, etsNone}},
+		{"AAdA", etsModel{etsAdditive, etsDamped, etsAdditive}},
+		{"MAM", etsModel{etsMultiplicative, etsAdditive, etsMultiplicative}},
+	} {
+		got, err := parseETSModel(tc.in)
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: expected %v. Got %v", tc.in, tc.want, got)
+		}
+	}
+	for _, bad := range []string{"", "AN", "XNN", "AMN", "AAxN", "ANNN"} {
+		if _, err := parseETSModel(bad); err == nil {
+			t.Errorf("Expected %q not to parse", bad)
+		}
+	}
+}
+
+func TestETS(t *testing.T) {
+	data := seasonalSeries(240, 1)
+	train, test := data[:216], data[216:]
+
+	e, err := autoETS(train, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Season == etsNone || e.Trend == etsNone {
+		t.Errorf("Expected a model with a trend and seasonality. Got %v", e)
+	}
+
+	// the forecasts have to follow the seasons: if they were off by a season, the error would be
+	// about the size of the amplitude
+	forecast := e.Forecast(len(test))
+	var mae float64
+	for i := range test {
+		mae += math.Abs(forecast[i]-test[i]) / float64(len(test))
+	}
+	if mae > 1 {
+		t.Errorf("Expected the mean absolute error of the forecast of %v to be under 1. Got %v", e, mae)
+	}
+
+	for _, m := range etsModels {
+		e, err := fitETS(train, 12, m)
+		if err != nil {
+			t.Errorf("%v: %v", m, err)
+			continue
+		}
+		if e.Alpha <= 0 || e.Alpha >= 1 || e.Gamma < 0 || e.Gamma > 1-e.Alpha || e.Phi < 0.8 || e.Phi > 1 {
+			t.Errorf("Expected the parameters of %v within the usual region. Got %v", m, e)
+		}
+	}
+}
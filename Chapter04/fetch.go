@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// fetcher downloads files over FTP or HTTP(S) into a local cache. A cached file that is younger
+// than MaxAge is used as it is; an older one is downloaded again, and is only used if the download
+// fails, so that the data can still be used offline.
+type fetcher struct {
+	CacheDir string
+	MaxAge   time.Duration
+
+	// Retries is the number of times a failed download is retried. The first retry waits Backoff,
+	// and every retry after that waits twice as long as the one before.
+	Retries int
+	Backoff time.Duration
+
+	// Timeout is the timeout of connecting, and of the whole download over HTTP.
+	Timeout time.Duration
+}
+
+// cacheEntry describes a cached file. It is kept as JSON next to the file.
+type cacheEntry struct {
+	URL     string    `json:"url"`
+	Fetched time.Time `json:"fetched"`
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+}
+
+// permanentError is an error that retrying will not fix.
+type permanentError struct{ error }
+
+// Fetch returns the path of the cached file of the URL, downloading it if needed.
+func (f fetcher) Fetch(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "ftp", "http", "https":
+	default:
+		return "", errors.Errorf("Unable to fetch %v: expected an ftp, http or https URL", rawurl)
+	}
+
+	key := cacheURL(u)
+	filename, metaname := f.cachePaths(key, u)
+	entry, cached := f.cached(filename, metaname, key)
+	if cached && time.Since(entry.Fetched) < f.MaxAge {
+		return filename, nil
+	}
+
+	backoff := f.Backoff
+	for attempt := 0; ; attempt++ {
+		if err = f.download(u, key, filename, metaname); err == nil {
+			return filename, nil
+		}
+		if _, ok := err.(permanentError); ok || attempt >= f.Retries {
+			break
+		}
+		log.Printf("Unable to fetch %v, retrying in %v: %v", key, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	if cached {
+		log.Printf("Unable to fetch %v, using the copy cached at %v: %v", key, entry.Fetched.Format(time.RFC3339), err)
+		return filename, nil
+	}
+	return "", errors.Wrapf(err, "Unable to fetch %v", key)
+}
+
+// cacheURL is the URL that the cache is keyed on and records: the parsed URL, with its password
+// redacted so that it is never written to disk or logged.
+func cacheURL(u *url.URL) string {
+	c := *u
+	if c.User != nil {
+		if _, ok := c.User.Password(); ok {
+			c.User = url.UserPassword(c.User.Username(), "xxxxx")
+		}
+	}
+	return c.String()
+}
+
+// cachePaths returns the paths of the cached file of the URL and of its cacheEntry. The names are
+// prefixed by a hash of the URL, so that files of the same name from different URLs are kept apart.
+func (f fetcher) cachePaths(key string, u *url.URL) (filename, metaname string) {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:8])
+	if base := path.Base(u.Path); base != "." && base != "/" {
+		name += "-" + base
+	}
+	filename = filepath.Join(f.CacheDir, name)
+	return filename, filename + ".json"
+}
+
+// cached returns the cacheEntry of the URL, if the file is cached and its checksum is right.
+func (f fetcher) cached(filename, metaname, key string) (entry cacheEntry, ok bool) {
+	meta, err := ioutil.ReadFile(metaname)
+	if err != nil {
+		return entry, false
+	}
+	if err := json.Unmarshal(meta, &entry); err != nil || entry.URL != key {
+		return entry, false
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return entry, false
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return entry, false
+	}
+	return entry, hex.EncodeToString(h.Sum(nil)) == entry.SHA256
+}
+
+// download downloads the URL into the cache, recording it under key. The file is written to a
+// temporary file first, so that a failed download never replaces the cached file.
+func (f fetcher) download(u *url.URL, key, filename, metaname string) error {
+	if err := os.MkdirAll(f.CacheDir, 0755); err != nil {
+		return permanentError{err}
+	}
+	tmp, err := ioutil.TempFile(f.CacheDir, ".fetch")
+	if err != nil {
+		return permanentError{err}
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := f.copyFrom(u, io.MultiWriter(tmp, h))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return permanentError{err}
+	}
+
+	meta, err := json.MarshalIndent(cacheEntry{
+		URL:     key,
+		Fetched: time.Now().UTC(),
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+		Size:    size,
+	}, "", "\t")
+	if err != nil {
+		return permanentError{err}
+	}
+	if err := ioutil.WriteFile(metaname, meta, 0644); err != nil {
+		return permanentError{err}
+	}
+	return nil
+}
+
+// copyFrom copies the contents of the URL to w.
+func (f fetcher) copyFrom(u *url.URL, w io.Writer) (int64, error) {
+	if u.Scheme == "ftp" {
+		return f.copyFromFTP(u, w)
+	}
+
+	client := &http.Client{Timeout: f.Timeout}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := errors.Errorf("%v", resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return 0, permanentError{err}
+		}
+		return 0, err
+	}
+	return io.Copy(w, resp.Body)
+}
+
+func (f fetcher) copyFromFTP(u *url.URL, w io.Writer) (int64, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host += ":21"
+	}
+	client, err := ftp.DialTimeout(host, f.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Quit()
+
+	user, password := "anonymous", "anonymous"
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			password = p
+		}
+	}
+	if err := client.Login(user, password); err != nil {
+		return 0, ftpError(err)
+	}
+	resp, err := client.Retr(u.Path)
+	if err != nil {
+		return 0, ftpError(err)
+	}
+	n, err := io.Copy(w, resp)
+	if cerr := resp.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// ftpError makes the permanent negative replies of an FTP server, like a missing file or a
+// refused login, permanentErrors.
+func ftpError(err error) error {
+	if e, ok := err.(*textproto.Error); ok && e.Code >= 500 {
+		return permanentError{err}
+	}
+	return err
+}
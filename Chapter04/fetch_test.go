@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ftpServer serves files over a passive mode FTP, just enough for the ftp client, and counts the
+// connections to it.
+func ftpServer(t *testing.T, files map[string]string, conns *int32) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(conns, 1)
+			go serveFTP(conn, files)
+		}
+	}()
+	return l
+}
+
+func serveFTP(conn net.Conn, files map[string]string) {
+	defer conn.Close()
+	var data net.Listener
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+	reply := func(format string, args ...interface{}) { fmt.Fprintf(conn, format+"\r\n", args...) }
+
+	reply("220 ready")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		switch fields[0] {
+		case "USER":
+			reply("331 password please")
+		case "PASS":
+			reply("230 logged in")
+		case "TYPE":
+			reply("200 ok")
+		case "EPSV":
+			if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				reply("425 no data connection")
+				continue
+			}
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "RETR":
+			contents, ok := files[strings.TrimPrefix(fields[1], "/")]
+			dc, err := data.Accept()
+			if err != nil {
+				reply("425 no data connection")
+				continue
+			}
+			if !ok {
+				dc.Close()
+				reply("550 no such file")
+				continue
+			}
+			reply("150 sending")
+			fmt.Fprint(dc, contents)
+			dc.Close()
+			reply("226 done")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestFetchFTP(t *testing.T) {
+	var conns int32
+	l := ftpServer(t, map[string]string{"products/co2.txt": noaaSample}, &conns)
+	defer l.Close()
+
+	f := fetcher{CacheDir: tempDir(t), MaxAge: time.Hour, Retries: 2, Backoff: time.Millisecond, Timeout: time.Second}
+	defer os.RemoveAll(f.CacheDir)
+	url := "FTP://noaa:secret@" + l.Addr().String() + "/products/co2.txt"
+	filename, err := f.Fetch(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filename); err != nil || string(b) != noaaSample {
+		t.Errorf("Expected the file served. Got %q, %v", b, err)
+	}
+
+	// the cache is found again under the URL as written, and never records the password
+	if _, err := f.Fetch(url); err != nil || atomic.LoadInt32(&conns) != 1 {
+		t.Errorf("Expected the cached copy to be used. Got %d connections, %v", conns, err)
+	}
+	if b, err := ioutil.ReadFile(filename + ".json"); err != nil || strings.Contains(string(b), "secret") {
+		t.Errorf("Expected the cache entry without the password. Got %s, %v", b, err)
+	}
+
+	// a missing file is not retried
+	atomic.StoreInt32(&conns, 0)
+	if _, err := f.Fetch("ftp://" + l.Addr().String() + "/missing.txt"); err == nil || atomic.LoadInt32(&conns) != 1 {
+		t.Errorf("Expected an error for a missing file, without retries. Got %d connections, %v", conns, err)
+	}
+}
+
+func TestFetchHTTP(t *testing.T) {
+	var hits, failures int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, noaaSample)
+	}))
+	url := srv.URL + "/co2.txt"
+
+	// fails twice, then succeeds
+	atomic.StoreInt32(&failures, 2)
+	f := fetcher{CacheDir: tempDir(t), MaxAge: time.Hour, Retries: 2, Backoff: time.Millisecond, Timeout: time.Second}
+	defer os.RemoveAll(f.CacheDir)
+	filename, err := f.Fetch(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filename); err != nil || string(b) != noaaSample {
+		t.Errorf("Expected the file served. Got %q, %v", b, err)
+	}
+	if hits != 3 {
+		t.Errorf("Expected 3 requests. Got %d", hits)
+	}
+
+	// a fresh copy is used without asking the server
+	if _, err := f.Fetch(url); err != nil || hits != 3 {
+		t.Errorf("Expected the cached copy to be used. Got %d requests, %v", hits, err)
+	}
+
+	// a stale copy is downloaded again
+	f.MaxAge = 0
+	if _, err := f.Fetch(url); err != nil || hits != 4 {
+		t.Errorf("Expected the stale copy to be downloaded again. Got %d requests, %v", hits, err)
+	}
+
+	// offline, the stale copy is used
+	srv.Close()
+	filename, err = f.Fetch(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filename); err != nil || string(b) != noaaSample {
+		t.Errorf("Expected the cached copy when offline. Got %q, %v", b, err)
+	}
+
+	// a corrupted copy is not used
+	if err := ioutil.WriteFile(filename, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Fetch(url); err == nil {
+		t.Errorf("Expected an error when offline with a corrupted cache")
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
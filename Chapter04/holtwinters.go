@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/chewxy/stl"
+	"gonum.org/v1/gonum/optimize"
+	"gonum.org/v1/gonum/stat"
+)
+
+// hwParams are the smoothing parameters of hw: alpha for the level, beta for the trend and gamma
+// for the seasonal component. Each is in [0, 1].
+type hwParams struct {
+	Alpha, Beta, Gamma float64
+}
+
+func (p hwParams) String() string {
+	return fmt.Sprintf("alpha=%.6f beta=%.6f gamma=%.6f", p.Alpha, p.Beta, p.Gamma)
+}
+
+// hwFit is the outcome of fitting the smoothing parameters of hw to a series.
+type hwFit struct {
+	hwParams
+	SSE      float64   // the in-sample sum of squared one-step-ahead errors
+	Forecast []float64 // the series followed by the forecast, as returned by hw
+}
+
+// hwSmooth runs the Holt-Winters recursions over the series, and returns the smoothed level,
+// trend and seasonal components. The level and trend start from the means of the first two
+// cycles, so the recursions do not have to climb from zero to the data.
+func hwSmooth(a stl.Result, periodicity int, p hwParams) (level, trend, seasonal []float64) {
+	level = make([]float64, len(a.Data))
+	trend = make([]float64, len(a.Trend))
+	seasonal = make([]float64, len(a.Seasonal))
+	copy(seasonal, a.Seasonal)
+	if len(a.Data) == 0 {
+		return
+	}
+	level[0], trend[0] = hwInit(a.Data, periodicity)
+
+	for i := range a.Data {
+		if i == 0 {
+			continue
+		}
+		level[i] = p.Alpha*a.Data[i] + (1-p.Alpha)*(level[i-1]+trend[i-1])
+		trend[i] = p.Beta*(level[i]-level[i-1]) + (1-p.Beta)*(trend[i-1])
+		if i-periodicity < 0 {
+			continue
+		}
+		seasonal[i] = p.Gamma*(a.Data[i]-level[i-1]-trend[i-1]) + (1-p.Gamma)*(seasonal[i-periodicity])
+	}
+	return
+}
+
+// hwInit returns the level and trend at the start of the series: the trend is the change in the
+// mean from the first cycle to the second, and the level is the mean of the first cycle taken back
+// to its start along the trend.
+func hwInit(y []float64, periodicity int) (level, trend float64) {
+	if periodicity < 1 || len(y) < periodicity {
+		return y[0], 0
+	}
+	first := stat.Mean(y[:periodicity], nil)
+	if len(y) >= 2*periodicity {
+		trend = (stat.Mean(y[periodicity:2*periodicity], nil) - first) / float64(periodicity)
+	}
+	return first - trend*float64(periodicity-1)/2, trend
+}
+
+// hwForecast forecasts the series h steps ahead of its end, from the level, trend and seasonal
+// components at its end.
+func hwForecast(a stl.Result, periodicity, h int, p hwParams) []float64 {
+	level, trend, seasonal := hwSmooth(a, periodicity, p)
+	return hwFrom(level, trend, seasonal, len(a.Data)-1, periodicity, h)
+}
+
+// hwFrom forecasts h steps ahead of observation t from the components at t. Every season takes the
+// seasonal component of its last cycle up to t.
+func hwFrom(level, trend, seasonal []float64, t, periodicity, h int) []float64 {
+	retVal := make([]float64, h)
+	for j := range retVal {
+		retVal[j] = level[t] + float64(j+1)*trend[t] + seasonal[t+1-periodicity+j%periodicity]
+	}
+	return retVal
+}
+
+// hwSSE is the sum of squared one-step-ahead errors of hw over the series. The errors are counted
+// from the second cycle on, once every season has a seasonal component to forecast with.
+func hwSSE(a stl.Result, periodicity int, p hwParams) (sse float64) {
+	level, trend, seasonal := hwSmooth(a, periodicity, p)
+	for i := periodicity; i < len(a.Data); i++ {
+		if i == 0 {
+			continue
+		}
+		e := a.Data[i] - (level[i-1] + trend[i-1] + seasonal[i-periodicity])
+		sse += e * e
+	}
+	return
+}
+
+// fitHW fits the smoothing parameters of hw to the series by minimizing the one-step-ahead SSE
+// with Nelder-Mead, starting from init. The parameters are kept within [0, 1] by optimizing
+// their logits instead.
+func fitHW(a stl.Result, periodicity, forward int, init hwParams) (hwFit, error) {
+	params := func(x []float64) hwParams {
+		return hwParams{Alpha: sigmoid(x[0]), Beta: sigmoid(x[1]), Gamma: sigmoid(x[2])}
+	}
+	problem := optimize.Problem{
+		Func: func(x []float64) float64 { return hwSSE(a, periodicity, params(x)) },
+	}
+	x0 := []float64{logit(init.Alpha), logit(init.Beta), logit(init.Gamma)}
+	settings := optimize.DefaultSettingsLocal()
+	settings.FunctionConverge = &optimize.FunctionConverge{Absolute: 1e-10, Relative: 1e-10, Iterations: 100}
+
+	result, err := optimize.Minimize(problem, x0, settings, &optimize.NelderMead{SimplexSize: 1})
+	if err != nil {
+		return hwFit{}, err
+	}
+	p := params(result.X)
+	return hwFit{
+		hwParams: p,
+		SSE:      result.F,
+		Forecast: hw(a, periodicity, forward, p.Alpha, p.Beta, p.Gamma),
+	}, nil
+}
+
+func sigmoid(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+
+// logit is the inverse of sigmoid. The parameter is kept away from 0 and 1 so the logit is finite.
+func logit(p float64) float64 {
+	const eps = 1e-6
+	p = math.Min(math.Max(p, eps), 1-eps)
+	return math.Log(p / (1 - p))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/chewxy/stl"
+)
+
+// seasonalSeries is a noisy series with a linear trend and a yearly cycle, like the CO2 data.
+func seasonalSeries(n int, seed int64) []float64 {
+	r := rand.New(rand.NewSource(seed))
+	retVal := make([]float64, n)
+	for i := range retVal {
+		retVal[i] = 300 + 0.1*float64(i) + 3*math.Sin(2*math.Pi*float64(i)/12) + r.NormFloat64()*0.3
+	}
+	return retVal
+}
+
+func TestFitHW(t *testing.T) {
+	data := seasonalSeries(240, 1)
+	decomposed := stl.Decompose(data, 12, 84, stl.Additive(), stl.WithIter(1))
+	if decomposed.Err != nil {
+		t.Fatal(decomposed.Err)
+	}
+
+	init := hwParams{0.1, 0.05, 0.1}
+	fitted, err := fitHW(decomposed, 12, 24, init)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []float64{fitted.Alpha, fitted.Beta, fitted.Gamma} {
+		if p < 0 || p > 1 {
+			t.Errorf("Expected the parameters within [0, 1]. Got %v", fitted.hwParams)
+		}
+	}
+	if sse := hwSSE(decomposed, 12, init); fitted.SSE > sse {
+		t.Errorf("Expected the fitted SSE %v to be no worse than the SSE of the initial parameters %v", fitted.SSE, sse)
+	}
+	if len(fitted.Forecast) != len(data)+24 {
+		t.Errorf("Expected %d values in the forecast. Got %d", len(data)+24, len(fitted.Forecast))
+	}
+}
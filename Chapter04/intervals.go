@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/chewxy/stl"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// predictionLevels are the coverages of the prediction intervals of the forecasts.
+var predictionLevels = []float64{0.80, 0.95}
+
+// simulations is the number of sample paths simulated for intervals that have no analytic form.
+const simulations = 5000
+
+// interval is a prediction interval: the series is expected between Lower and Upper with
+// probability Level.
+type interval struct {
+	Level        float64
+	Lower, Upper []float64
+}
+
+// prediction is a forecast with its prediction intervals, narrowest first.
+type prediction struct {
+	Point     []float64
+	Intervals []interval
+}
+
+// normalIntervals are the intervals of forecasts with normal errors of the given variances.
+func normalIntervals(point, variances []float64) []interval {
+	retVal := make([]interval, len(predictionLevels))
+	for i, level := range predictionLevels {
+		z := distuv.UnitNormal.Quantile(0.5 + level/2)
+		in := interval{Level: level, Lower: make([]float64, len(point)), Upper: make([]float64, len(point))}
+		for h := range point {
+			sd := math.Sqrt(variances[h])
+			in.Lower[h] = point[h] - z*sd
+			in.Upper[h] = point[h] + z*sd
+		}
+		retVal[i] = in
+	}
+	return retVal
+}
+
+// simulatedIntervals are the intervals between the quantiles of the simulated sample paths at
+// every step.
+func simulatedIntervals(paths [][]float64) []interval {
+	h := len(paths[0])
+	retVal := make([]interval, len(predictionLevels))
+	for i, level := range predictionLevels {
+		retVal[i] = interval{Level: level, Lower: make([]float64, h), Upper: make([]float64, h)}
+	}
+	step := make([]float64, len(paths))
+	for j := 0; j < h; j++ {
+		for k, path := range paths {
+			step[k] = path[j]
+		}
+		sort.Float64s(step)
+		for i, level := range predictionLevels {
+			retVal[i].Lower[j] = stat.Quantile((1-level)/2, stat.Empirical, step, nil)
+			retVal[i].Upper[j] = stat.Quantile((1+level)/2, stat.Empirical, step, nil)
+		}
+	}
+	return retVal
+}
+
+// Predict forecasts the series h steps ahead of its end, with prediction intervals. The intervals
+// of models with additive errors and no multiplicative season are analytic (Hyndman et al., 2008,
+// chapter 6); the others are simulated.
+func (e *ets) Predict(h int) prediction {
+	point := e.Forecast(h)
+	if e.Error == etsAdditive && e.Season != etsMultiplicative {
+		return prediction{point, normalIntervals(point, e.variances(h))}
+	}
+	return prediction{point, simulatedIntervals(e.simulate(h, simulations, rand.New(rand.NewSource(1))))}
+}
+
+// variances are the variances of the forecast errors 1 to h steps ahead of a model with additive
+// errors and no multiplicative season: σ²(1 + c₁² + ... + cₕ₋₁²), where cⱼ = α(1 + β*φⱼ) + γ if j is a whole number of
+// periods, and cⱼ = α(1 + β*φⱼ) otherwise.
+func (e *ets) variances(h int) []float64 {
+	retVal := make([]float64, h)
+	sum := 1.0
+	for j := 1; j <= h; j++ {
+		retVal[j-1] = e.Sigma2 * sum
+		c := e.Alpha * (1 + e.Beta*e.damp(e.Phi, j))
+		if e.Season != etsNone && j%e.Period == 0 {
+			c += e.Gamma
+		}
+		sum += c * c
+	}
+	return retVal
+}
+
+// simulate simulates n sample paths of the series h steps ahead of its end, with normal errors
+// of the variance of the residuals.
+func (e *ets) simulate(h, n int, r *rand.Rand) [][]float64 {
+	sd := math.Sqrt(e.Sigma2)
+	paths := make([][]float64, n)
+	for k := range paths {
+		path := make([]float64, h)
+		st := e.final.clone()
+		last := st.Level
+		for j := range path {
+			t := e.n + j
+			mu, lb, season, ok := e.predict(st, t, e.Phi)
+			if !ok {
+				// the path has left the range of the model, and stays where it was
+				for ; j < h; j++ {
+					path[j] = last
+				}
+				break
+			}
+			if e.Error == etsMultiplicative {
+				path[j] = mu * (1 + sd*r.NormFloat64())
+			} else {
+				path[j] = mu + sd*r.NormFloat64()
+			}
+			e.update(&st, t, path[j], lb, season, e.etsParams)
+			last = path[j]
+		}
+		paths[k] = path
+	}
+	return paths
+}
+
+// hwPredict is hw with prediction intervals. The sample paths are simulated by adding, at every
+// horizon, errors resampled from the in-sample errors of the forecasts that many steps ahead of
+// every observation from the second cycle on, as in hwSSE.
+func hwPredict(a stl.Result, periodicity, forward int, p hwParams) (prediction, error) {
+	level, trend, seasonal := hwSmooth(a, periodicity, p)
+	n := len(a.Data)
+	if n-1-periodicity < forward {
+		return prediction{}, errors.Errorf("The series of %d observations is too short for intervals %d steps ahead", n, forward)
+	}
+	errs := make([][]float64, forward)
+	for t := periodicity; t < n-1; t++ {
+		h := forward
+		if h > n-1-t {
+			h = n - 1 - t
+		}
+		for j, f := range hwFrom(level, trend, seasonal, t, periodicity, h) {
+			errs[j] = append(errs[j], a.Data[t+1+j]-f)
+		}
+	}
+
+	point := hwFrom(level, trend, seasonal, n-1, periodicity, forward)
+	r := rand.New(rand.NewSource(1))
+	paths := make([][]float64, simulations)
+	for k := range paths {
+		paths[k] = make([]float64, len(point))
+		for j := range point {
+			paths[k][j] = point[j] + errs[j][r.Intn(len(errs[j]))]
+		}
+	}
+	return prediction{point, simulatedIntervals(paths)}, nil
+}
+
+// writeIntervals writes the forecasts and their intervals as CSV, one row per date:
+// date,forecast,lo80,hi80,lo95,hi95.
+func writeIntervals(w io.Writer, dates []time.Time, p prediction) error {
+	cw := csv.NewWriter(w)
+	header := []string{"date", "forecast"}
+	for _, in := range p.Intervals {
+		header = append(header, fmt.Sprintf("lo%.0f", in.Level*100), fmt.Sprintf("hi%.0f", in.Level*100))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for i, point := range p.Point {
+		record := []string{dates[i].Format("2006-01-02"), strconv.FormatFloat(point, 'f', -1, 64)}
+		for _, in := range p.Intervals {
+			record = append(record, strconv.FormatFloat(in.Lower[i], 'f', -1, 64), strconv.FormatFloat(in.Upper[i], 'f', -1, 64))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeIntervalsFile writes the forecasts and their intervals to the named CSV file.
+func writeIntervalsFile(filename string, dates []time.Time, p prediction) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := writeIntervals(f, dates, p); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
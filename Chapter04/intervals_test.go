@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETSIntervals(t *testing.T) {
+	data := seasonalSeries(240, 1)
+	m, _ := parseETSModel("AAA")
+	e, err := fitETS(data, 12, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the analytic intervals should agree with the simulated ones
+	analytic := e.Predict(24)
+	simulated := simulatedIntervals(e.simulate(24, 20000, rand.New(rand.NewSource(1))))
+	for i, in := range analytic.Intervals {
+		for h := range in.Lower {
+			if in.Lower[h] >= analytic.Point[h] || in.Upper[h] <= analytic.Point[h] {
+				t.Fatalf("Expected the %v interval %d steps ahead around the forecast", in.Level, h+1)
+			}
+			width, simWidth := in.Upper[h]-in.Lower[h], simulated[i].Upper[h]-simulated[i].Lower[h]
+			if math.Abs(width-simWidth) > 0.1*width {
+				t.Errorf("%v interval %d steps ahead: expected the analytic width %v close to the simulated width %v", in.Level, h+1, width, simWidth)
+			}
+		}
+	}
+	if analytic.Intervals[0].Upper[23]-analytic.Intervals[0].Lower[23] <= analytic.Intervals[0].Upper[0]-analytic.Intervals[0].Lower[0] {
+		t.Errorf("Expected the intervals to widen with the horizon")
+	}
+
+	var buf bytes.Buffer
+	dates := timeIndex{[]time.Time{time.Date(2018, time.May, 1, 0, 0, 0, 0, time.UTC)}, monthly}.extend(24)[1:]
+	if err := writeIntervals(&buf, dates, analytic); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[0] != "date,forecast,lo80,hi80,lo95,hi95" {
+		t.Errorf("Unexpected header %q", lines[0])
+	}
+	if len(lines) != 25 || !strings.HasPrefix(lines[1], "2018-06-01,") {
+		t.Errorf("Expected a row for every month from 2018-06-01. Got %d lines, starting with %q", len(lines), lines[1])
+	}
+}
+
+func TestETSIntervalsMultiplicativeSeason(t *testing.T) {
+	// a wandering level with seasonal swings in proportion to it
+	r := rand.New(rand.NewSource(1))
+	data := make([]float64, 240)
+	level := 100.0
+	for i := range data {
+		level += 0.5 + 2*r.NormFloat64()
+		data[i] = level*(1+0.6*math.Sin(2*math.Pi*float64(i)/12)) + r.NormFloat64()
+	}
+	m, _ := parseETSModel("AAM")
+	e, err := fitETS(data, 12, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the level uncertainty is scaled by the seasonal factor, which the analytic variances of the
+	// additive models leave out, so the intervals should follow the simulated ones instead
+	pred := e.Predict(24)
+	simulated := simulatedIntervals(e.simulate(24, 20000, rand.New(rand.NewSource(2))))
+	for i, in := range pred.Intervals {
+		for h := range in.Lower {
+			width, simWidth := in.Upper[h]-in.Lower[h], simulated[i].Upper[h]-simulated[i].Lower[h]
+			if math.Abs(width-simWidth) > 0.1*simWidth {
+				t.Errorf("%v interval %d steps ahead: expected the width %v close to the simulated width %v", in.Level, h+1, width, simWidth)
+			}
+		}
+	}
+}
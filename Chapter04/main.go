@@ -1,65 +1,118 @@
 package main
 
 import (
-	"bufio"
-	"image/color"
+	"flag"
+	"fmt"
 	"io"
 	"log"
-	"math"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/chewxy/stl"
-	"github.com/jlaffaye/ftp"
-	"gonum.org/v1/plot/plotter"
+	"github.com/pkg/errors"
 	"gonum.org/v1/plot/vg"
 )
 
-type loader func() io.Reader
+var (
+	fit   = flag.Bool("fit", false, "fit the Holt-Winters smoothing parameters to the data, starting from -alpha, -beta and -gamma")
+	alpha = flag.Float64("alpha", 0.1, "Holt-Winters smoothing parameter of the level")
+	beta  = flag.Float64("beta", 0.05, "Holt-Winters smoothing parameter of the trend")
+	gamma = flag.Float64("gamma", 0.1, "Holt-Winters smoothing parameter of the seasonal component")
+	model = flag.String("model", "hw", "forecasting model: hw (Holt-Winters on the STL decomposition), ets or arima")
+	etsM  = flag.String("ets", "auto", "ETS model, like ANN, AAdN or MAM, or auto to choose the one with the lowest AIC")
+	order = flag.String("arima", "auto", "ARIMA order p,d,q or p,d,q,P,D,Q, or auto to choose one by AIC")
+	estim = flag.String("estimation", string(arimaCSSML), "estimation of the ARIMA model: css, ml or css-ml")
 
-func readFromFile() io.Reader {
-	reader, err := os.Open("data.txt")
-	dieIfErr(err)
-	return reader
-}
+	backtestModels = flag.String("backtest", "", "backtest these models, separated by commas (hw, ets or arima), instead of forecasting")
+	horizon        = flag.Int("horizon", 12, "backtest: the number of steps to forecast from every origin")
+	initial        = flag.Int("initial", 0, "backtest: the number of observations before the first origin (defaults to all but the last ten seasonal cycles, or half the series if it is shorter)")
+	step           = flag.Int("step", 12, "backtest: the number of steps between origins")
+	window         = flag.String("window", "expanding", "backtest: fit to an expanding or sliding window")
 
-func download() io.Reader {
-	client, err := ftp.Dial("aftp.cmdl.noaa.gov:21")
-	dieIfErr(err)
-	dieIfErr(client.Login("anonymous", "anonymous"))
-	reader, err := client.Retr("products/trends/co2/co2_mm_mlo.txt")
-	dieIfErr(err)
-	return reader
+	dataFile   = flag.String("data", "data.txt", "the file of the series")
+	dataURL    = flag.String("url", "", "download the series from this ftp, http or https URL instead of reading -data, like ftp://aftp.cmdl.noaa.gov/products/trends/co2/co2_mm_mlo.txt")
+	cacheDir   = flag.String("cache", "cache", "the directory to cache downloaded series in")
+	maxAge     = flag.Duration("maxage", 24*time.Hour, "download the series again if the cached copy is older than this")
+	format     = flag.String("format", "noaa", "the format of the series: noaa (NOAA's monthly CO2 data), csv or json")
+	column     = flag.String("column", "interpolated", "noaa: the column of the values: average, interpolated or trend")
+	dateCol    = flag.String("datecol", "date", "csv and json: the column of the dates")
+	valueCol   = flag.String("valuecol", "value", "csv and json: the column of the values")
+	layout     = flag.String("layout", "", "csv and json: the layout of the dates, as in time.Parse, or decimal for decimal years (defaults to RFC 3339)")
+	missingVal = flag.String("missing", "", "csv and json: the values that mark missing observations, separated by commas")
+
+	freq     = flag.String("freq", "auto", "the frequency of the series: daily, weekly, monthly, or auto to infer it from the dates")
+	resample = flag.String("resample", "", "resample the series to this frequency (daily, weekly or monthly) before forecasting")
+	agg      = flag.String("agg", string(aggMean), "resample: how to combine the observations in a step: sum, mean or last")
+	forward  = flag.Int("forward", 0, "the number of steps to forecast (defaults to ten seasonal cycles)")
+
+	intervalsCSV = flag.String("intervals", "forecast.csv", "write the forecasts and their prediction intervals to this CSV file, if not empty")
+)
+
+type loader func() (io.ReadCloser, error)
+
+func readFromFile() (io.ReadCloser, error) { return os.Open(*dataFile) }
+
+// download fetches the series from -url into the cache, and opens the cached copy.
+func download() (io.ReadCloser, error) {
+	f := fetcher{CacheDir: *cacheDir, MaxAge: *maxAge, Retries: 3, Backoff: time.Second, Timeout: 30 * time.Second}
+	filename, err := f.Fetch(*dataURL)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filename)
 }
 
-func parse(l loader) (dates []string, co2s []float64) {
-	s := bufio.NewScanner(l())
-	for s.Scan() {
-		row := s.Text()
-		if strings.HasPrefix(row, "#") {
-			continue
+// parse reads the series in the format of the flags.
+func parse(l loader) (series, error) {
+	r, err := l()
+	if err != nil {
+		return series{}, err
+	}
+	defer r.Close()
+	switch *format {
+	case "noaa":
+		return parseNOAA(r, *column)
+	case "csv", "json":
+		f := seriesFormat{DateColumn: *dateCol, ValueColumn: *valueCol, Layout: *layout}
+		if *missingVal != "" {
+			f.Missing = strings.Split(*missingVal, ",")
 		}
-		fields := strings.Fields(row)
-		dates = append(dates, fields[2])
-		co2, err := strconv.ParseFloat(fields[4], 64)
-		dieIfErr(err)
-		co2s = append(co2s, co2)
+		if *format == "csv" {
+			return readCSVSeries(r, f)
+		}
+		return readJSONSeries(r, f)
 	}
-	return
+	return series{}, errors.Errorf("Unknown format %q. Expected noaa, csv or json", *format)
 }
 
 func main() {
-	dateStrings, co2s := parse(readFromFile)
-	dates := parseDates(dateStrings)
+	flag.Parse()
+	l := readFromFile
+	if *dataURL != "" {
+		l = download
+	}
+	s, err := parse(l)
+	dieIfErr(err)
+	s, ix, err := index(s)
+	dieIfErr(err)
+	period := ix.Freq.period()
+	if n := s.missing(); n > 0 {
+		log.Printf("%d of %d observations are missing, and are interpolated", n, len(s.Values))
+	}
+	dates, co2s := s.Times, s.filled()
 	plt := newTSPlot(dates, co2s, "CO2 Level")
 	plt.X.Label.Text = "Time"
 	plt.Y.Label.Text = "CO2 in the atmosphere (ppm)"
 	plt.Title.Text = "CO2 in the atmosphere (ppm) over time\nTaken over the Mauna-Loa observatory"
 	dieIfErr(plt.Save(25*vg.Centimeter, 25*vg.Centimeter, "Moana-Loa.png"))
 
-	decomposed := stl.Decompose(co2s, 12, 84, stl.Additive(),
+	if *backtestModels != "" {
+		runBacktest(co2s, period, strings.Split(*backtestModels, ","))
+		return
+	}
+
+	decomposed := stl.Decompose(co2s, period, 7*period, stl.Additive(),
 		stl.WithIter(1),
 		// stl.WithTrendConfig(stl.Config{Jump: 1, Width: 18, Fn: loess.Linear}),
 		// stl.WithSeasonalConfig(stl.Config{Jump: 1, Width: 1, Fn: loess.Linear}),
@@ -70,86 +123,169 @@ func main() {
 	plts := plotDecomposed(dates, decomposed)
 	writeToPng(plts, "CO2 in the atmosphere (ppm), decomposed", "decomposed.png", 25, 25)
 
-	lies := stl.Decompose(co2s, 60, 84, stl.Additive(), stl.WithIter(1))
+	lies := stl.Decompose(co2s, 5*period, 7*period, stl.Additive(), stl.WithIter(1))
 	dieIfErr(lies.Err)
 	plts2 := plotDecomposed(dates, lies)
 	writeToPng(plts2, "CO2 in the atmosphere (ppm), decomposed (Liar Edition)", "lies.png", 25, 25)
 
-	fwd := 120
-	forecast := hw(decomposed, 12, fwd, 0.1, 0.05, 0.1)
-	datesplus := forecastTime(dates, fwd)
-	forecastPlot := newTSPlot(datesplus, forecast, "")
-	maxY := math.Inf(-1)
-	minY := math.Inf(1)
-	for i := range forecast {
-		if forecast[i] > maxY {
-			maxY = forecast[i]
+	fwd := *forward
+	if fwd <= 0 {
+		fwd = 10 * period
+	}
+	var forecast []float64
+	var pred prediction
+	switch *model {
+	case "hw":
+		params := hwParams{*alpha, *beta, *gamma}
+		if *fit {
+			fitted, err := fitHW(decomposed, period, fwd, params)
+			dieIfErr(err)
+			params = fitted.hwParams
+			log.Printf("Fitted Holt-Winters parameters: %v (SSE %.4f)", params, fitted.SSE)
+			log.Printf("To reproduce the forecast: -alpha=%v -beta=%v -gamma=%v", params.Alpha, params.Beta, params.Gamma)
 		}
-		if forecast[i] < minY {
-			minY = forecast[i]
+		forecast = hw(decomposed, period, fwd, params.Alpha, params.Beta, params.Gamma)
+		pred, err = hwPredict(decomposed, period, fwd, params)
+		dieIfErr(err)
+	case "ets":
+		e, err := newETS(co2s, period, *etsM)
+		dieIfErr(err)
+		log.Printf("Fitted %v", e)
+		pred = e.Predict(fwd)
+		forecast = append(append([]float64(nil), co2s...), pred.Point...)
+	case "arima":
+		for _, d := range []int{0, 1} {
+			x := difference(co2s, d, 0, period)
+			test, err := adf(x, -1, d == 0)
+			dieIfErr(err)
+			log.Printf("Differenced %d times: %v", d, test)
+			log.Printf("Differenced %d times: %v", d, kpss(x, -1, d == 0))
 		}
+		a, err := newARIMA(co2s, period, *order, arimaMethod(*estim))
+		dieIfErr(err)
+		log.Printf("Fitted %v", a)
+		pred = a.Predict(fwd)
+		forecast = append(append([]float64(nil), co2s...), pred.Point...)
+	default:
+		log.Fatalf("Unknown model %q. Expected hw, ets or arima", *model)
+	}
+	datesplus := ix.extend(fwd)
+	if *intervalsCSV != "" {
+		dieIfErr(writeIntervalsFile(*intervalsCSV, datesplus[len(dates):], pred))
 	}
-	// extend the range a little
-	minY--
-	maxY++
-	maxX := float64(datesplus[len(datesplus)-1].Unix())
-	minX := float64(datesplus[len(dates)-1].Unix())
+	forecastPlot := newTSPlot(datesplus, forecast, "", pred.Intervals...)
+	writeToPng(forecastPlot, fmt.Sprintf("Forecasted CO2 levels\n(%d %s steps)", fwd, ix.Freq), "forecast.png", 25, 25)
+}
 
-	shadePoly := plotter.XYs{
-		{X: minX, Y: minY},
-		{X: maxX, Y: minY},
-		{X: maxX, Y: maxY},
-		{X: minX, Y: maxY},
+// index resamples the series as the flags say, and returns it with its time index. The series
+// must be regular, so that it has a seasonal period.
+func index(s series) (series, timeIndex, error) {
+	ix := newTimeIndex(s.Times)
+	if *freq != "auto" {
+		f, err := parseFrequency(*freq)
+		if err != nil {
+			return s, ix, err
+		}
+		ix.Freq = f
 	}
-	poly, err := plotter.NewPolygon(shadePoly)
-	dieIfErr(err)
-	poly.Color = color.RGBA{A: 16}
-	poly.LineStyle.Color = color.RGBA{}
-	forecastPlot.Add(poly)
+	if *resample != "" {
+		f, err := parseFrequency(*resample)
+		if err != nil {
+			return s, ix, err
+		}
+		if s, err = s.resample(f, aggregation(*agg)); err != nil {
+			return s, ix, err
+		}
+		ix = timeIndex{Times: s.Times, Freq: f}
+	}
+	if ix.Freq == irregular {
+		return s, ix, errors.New("The series is irregular. Resample it with -resample daily, weekly or monthly")
+	}
+	log.Printf("%d %v observations, with a seasonal period of %d", len(s.Values), ix.Freq, ix.Freq.period())
+	return s, ix, nil
+}
 
-	writeToPng(forecastPlot, "Forecasted CO2 levels\n(10 years)", "forecast.png", 25, 25)
+// newForecaster returns the named model with the parameters of the flags, for backtesting.
+func newForecaster(name string, period int) (forecaster, error) {
+	switch name {
+	case "hw":
+		return hwForecaster{Period: period, Width: 7 * period, Params: hwParams{*alpha, *beta, *gamma}, Optimize: *fit}, nil
+	case "ets":
+		return etsForecaster{Period: period, Model: *etsM}, nil
+	case "arima":
+		return arimaForecaster{Period: period, Order: *order, Method: arimaMethod(*estim)}, nil
+	}
+	return nil, errors.Errorf("Unknown model %q. Expected hw, ets or arima", name)
 }
 
-func dieIfErr(err error) {
-	if err != nil {
-		log.Fatal(err)
+// runBacktest backtests the named models on the series, prints their errors, and plots them
+// against the horizon.
+func runBacktest(y []float64, period int, names []string) {
+	b := backtest{Initial: *initial, Horizon: *horizon, Step: *step, Period: period}
+	if b.Initial <= 0 {
+		b.Initial = len(y) - 10*period
+		if b.Initial < len(y)/2 {
+			b.Initial = len(y) / 2
+		}
+	}
+	switch *window {
+	case "expanding":
+	case "sliding":
+		b.Sliding = true
+	default:
+		log.Fatalf("Unknown window %q. Expected expanding or sliding", *window)
+	}
+
+	accs := make([]accuracy, len(names))
+	for i, name := range names {
+		f, err := newForecaster(name, period)
+		dieIfErr(err)
+		accs[i], err = b.Run(f, y)
+		dieIfErr(err)
+		log.Printf("Backtested %v from %d origins", name, accs[i].Origins)
 	}
+	dieIfErr(writeAccuracy(os.Stdout, names, accs))
+	writeToPng(plotAccuracy(names, accs), "Forecast errors by horizon", "accuracy.png", 25, 40)
 }
 
-func forecastTime(dates []time.Time, forwards int) []time.Time {
-	retVal := append(dates, make([]time.Time, forwards)...)
-	lastDate := dates[len(dates)-1]
-	for i := len(dates); i < len(retVal); i++ {
-		retVal[i] = lastDate.AddDate(0, 1, 0)
-		lastDate = retVal[i]
+// newETS fits the named ETS model to the series, or chooses one by AIC if the name is "auto".
+func newETS(y []float64, period int, name string) (*ets, error) {
+	if name == "auto" {
+		return autoETS(y, period)
 	}
-	return retVal
+	m, err := parseETSModel(name)
+	if err != nil {
+		return nil, err
+	}
+	return fitETS(y, period, m)
 }
 
-func hw(a stl.Result, periodicity, forward int, alpha, beta, gamma float64) []float64 {
-	level := make([]float64, len(a.Data))
-	trend := make([]float64, len(a.Trend))
-	seasonal := make([]float64, len(a.Seasonal))
-	forecast := make([]float64, len(a.Data)+forward)
-	copy(seasonal, a.Seasonal)
-
-	for i := range a.Data {
-		if i == 0 {
-			continue
-		}
-		level[i] = alpha*a.Data[i] + (1-alpha)*(level[i-1]+trend[i-1])
-		trend[i] = beta*(level[i]-level[i-1]) + (1-beta)*(trend[i-1])
-		if i-periodicity < 0 {
-			continue
-		}
-		seasonal[i] = gamma*(a.Data[i]-level[i-1]-trend[i-1]) + (1-gamma)*(seasonal[i-periodicity])
+// newARIMA fits the ARIMA model of the given order to the series, or chooses an order by AIC if
+// the order is "auto".
+func newARIMA(y []float64, period int, order string, method arimaMethod) (*arima, error) {
+	switch method {
+	case arimaCSS, arimaML, arimaCSSML:
+	default:
+		return nil, errors.Errorf("Unknown estimation %q. Expected css, ml or css-ml", method)
+	}
+	if order == "auto" {
+		return autoARIMA(y, period, method)
+	}
+	o, err := parseARIMAOrder(order, period)
+	if err != nil {
+		return nil, err
 	}
+	return fitARIMA(y, o, method)
+}
 
-	hplus := ((periodicity - 1) % forward) + 1
-	for i := 0; i+forward < len(forecast); i++ {
-		forecast[i+forward] = level[i] + float64(forward)*trend[i] + seasonal[i-periodicity+hplus]
+func dieIfErr(err error) {
+	if err != nil {
+		log.Fatal(err)
 	}
-	copy(forecast, a.Data)
+}
 
-	return forecast
+// hw returns the series followed by its forecast forward steps ahead of its end.
+func hw(a stl.Result, periodicity, forward int, alpha, beta, gamma float64) []float64 {
+	forecast := append([]float64(nil), a.Data...)
+	return append(forecast, hwForecast(a, periodicity, forward, hwParams{alpha, beta, gamma})...)
 }
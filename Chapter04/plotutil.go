@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"image/color"
 	"math"
 	"os"
@@ -82,9 +83,21 @@ func (r *residChart) Thumbnail(c *draw.Canvas) {
 	c.StrokeLine2(r.LineStyle, c.Min.X, y, c.Max.X, y)
 }
 
-func newTSPlot(xs []time.Time, ys []float64, seriesName string) *plot.Plot {
+// newTSPlot plots the series. The prediction intervals are drawn as bands over the last dates.
+func newTSPlot(xs []time.Time, ys []float64, seriesName string, bands ...interval) *plot.Plot {
 	p, err := plot.New()
 	dieIfErr(err)
+	// the widest band goes first, so the narrower ones are drawn over it
+	for i := len(bands) - 1; i >= 0; i-- {
+		poly := newBand(xs, bands[i])
+		shade := uint8(48 + 48*(len(bands)-1-i))
+		poly.Color = color.RGBA{R: shade / 2, G: shade / 2, B: shade, A: shade}
+		poly.LineStyle.Color = color.RGBA{}
+		p.Add(poly)
+		p.Legend.Add(fmt.Sprintf("%.0f%% prediction interval", bands[i].Level*100), poly)
+		p.Legend.TextStyle.Font = defaultFont
+	}
+
 	xys := make(plotter.XYs, len(ys))
 	for i := range ys {
 		xys[i].X = float64(xs[i].Unix())
@@ -111,6 +124,21 @@ func newTSPlot(xs []time.Time, ys []float64, seriesName string) *plot.Plot {
 	return p
 }
 
+// newBand is the polygon between the lower and upper bounds of the interval, which are for the
+// last dates.
+func newBand(xs []time.Time, in interval) *plotter.Polygon {
+	xs = xs[len(xs)-len(in.Lower):]
+	xys := make(plotter.XYs, 2*len(xs))
+	for i := range xs {
+		j := len(xys) - 1 - i
+		xys[i].X, xys[i].Y = float64(xs[i].Unix()), in.Lower[i]
+		xys[j].X, xys[j].Y = float64(xs[i].Unix()), in.Upper[i]
+	}
+	poly, err := plotter.NewPolygon(xys)
+	dieIfErr(err)
+	return poly
+}
+
 func newResidPlot(xs []time.Time, ys []float64, seriesName string) *plot.Plot {
 	p, err := plot.New()
 	dieIfErr(err)
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// series is a time series. The values of the missing observations are NaN.
+type series struct {
+	Times   []time.Time
+	Values  []float64
+	Missing []bool
+}
+
+func (s *series) add(t time.Time, v float64, missing bool) {
+	if missing {
+		v = math.NaN()
+	}
+	s.Times = append(s.Times, t)
+	s.Values = append(s.Values, v)
+	s.Missing = append(s.Missing, missing)
+}
+
+// missing is the number of missing observations.
+func (s series) missing() (n int) {
+	for _, m := range s.Missing {
+		if m {
+			n++
+		}
+	}
+	return
+}
+
+// filled returns the values with the missing observations linearly interpolated between their
+// neighbours. Missing observations at the ends take the value of the nearest observation.
+func (s series) filled() []float64 {
+	retVal := append([]float64(nil), s.Values...)
+	prev := -1
+	for i := 0; i <= len(retVal); i++ {
+		if i < len(retVal) && s.Missing[i] {
+			continue
+		}
+		// fill the gap between prev and i
+		for j := prev + 1; j < i; j++ {
+			switch {
+			case prev < 0 && i == len(retVal):
+				retVal[j] = 0
+			case prev < 0:
+				retVal[j] = retVal[i]
+			case i == len(retVal):
+				retVal[j] = retVal[prev]
+			default:
+				frac := float64(j-prev) / float64(i-prev)
+				retVal[j] = retVal[prev] + frac*(retVal[i]-retVal[prev])
+			}
+		}
+		prev = i
+	}
+	return retVal
+}
+
+// noaaFill is the value NOAA uses for missing monthly averages.
+const noaaFill = -99.99
+
+// noaaColumns are the columns of NOAA's monthly CO2 data that hold values.
+var noaaColumns = map[string]int{"average": 3, "interpolated": 4, "trend": 5}
+
+// parseNOAA parses NOAA's monthly CO2 data: lines of year, month, decimal date, average,
+// interpolated, trend and number of days, with comments starting with #. The values are read
+// from the named column; averages of -99.99 are missing. The dates are in Hawaii, where the
+// observatory is.
+func parseNOAA(r io.Reader, column string) (series, error) {
+	col, ok := noaaColumns[column]
+	if !ok {
+		return series{}, errors.Errorf("Unknown column %q. Expected average, interpolated or trend", column)
+	}
+	loc, err := time.LoadLocation("Pacific/Honolulu")
+	if err != nil {
+		return series{}, err
+	}
+
+	var s series
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		row := strings.TrimSpace(sc.Text())
+		if row == "" || strings.HasPrefix(row, "#") {
+			continue
+		}
+		fields := strings.Fields(row)
+		if len(fields) < 7 {
+			return s, errors.Errorf("Line %d: expected 7 fields. Got %d", line, len(fields))
+		}
+		t, err := parseDecimalDate(fields[2], loc)
+		if err != nil {
+			return s, errors.Wrapf(err, "Line %d", line)
+		}
+		v, err := strconv.ParseFloat(fields[col], 64)
+		if err != nil {
+			return s, errors.Wrapf(err, "Line %d", line)
+		}
+		s.add(t, v, v == noaaFill)
+	}
+	return s, sc.Err()
+}
+
+// seriesFormat says where a generic CSV or JSON series keeps its dates and values.
+type seriesFormat struct {
+	DateColumn, ValueColumn string
+
+	// Layout is the layout of the dates, as in time.Parse. It is RFC 3339 if empty, and
+	// decimal years, like 2018.375, if "decimal".
+	Layout string
+
+	// Missing lists the values that mark missing observations, besides empty values and NaN.
+	Missing []string
+}
+
+func (f seriesFormat) parseTime(s string) (time.Time, error) {
+	return parseTimeLayout(s, f.Layout, time.UTC)
+}
+
+// parseValue parses a value, and reports whether it is missing.
+func (f seriesFormat) parseValue(s string) (float64, bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "nan") || strings.EqualFold(s, "na") {
+		return 0, true, nil
+	}
+	for _, m := range f.Missing {
+		if s == m {
+			return 0, true, nil
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, false, err
+}
+
+// readCSVSeries reads a series from a CSV file with a header, which names the columns.
+func readCSVSeries(r io.Reader, f seriesFormat) (series, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return series{}, errors.Wrap(err, "Unable to read the header")
+	}
+	dateCol, valueCol := -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case f.DateColumn:
+			dateCol = i
+		case f.ValueColumn:
+			valueCol = i
+		}
+	}
+	if dateCol < 0 || valueCol < 0 {
+		return series{}, errors.Errorf("Expected columns %q and %q. Got %v", f.DateColumn, f.ValueColumn, header)
+	}
+
+	var s series
+	for record := 2; ; record++ {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return s, err
+		}
+		if len(fields) <= dateCol || len(fields) <= valueCol {
+			return s, errors.Errorf("Record %d: expected the fields %q and %q. Got %d fields", record, f.DateColumn, f.ValueColumn, len(fields))
+		}
+		t, err := f.parseTime(strings.TrimSpace(fields[dateCol]))
+		if err != nil {
+			return s, errors.Wrapf(err, "Record %d", record)
+		}
+		v, missing, err := f.parseValue(fields[valueCol])
+		if err != nil {
+			return s, errors.Wrapf(err, "Record %d", record)
+		}
+		s.add(t, v, missing)
+	}
+}
+
+// readJSONSeries reads a series from a JSON array of objects, whose fields are the columns. The
+// values may be numbers, strings or null, which is missing.
+func readJSONSeries(r io.Reader, f seriesFormat) (series, error) {
+	var records []map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return series{}, err
+	}
+
+	var s series
+	for i, record := range records {
+		rawDate, ok := record[f.DateColumn]
+		if !ok {
+			return s, errors.Errorf("Record %d: expected the field %q", i, f.DateColumn)
+		}
+		var date string
+		if err := json.Unmarshal(rawDate, &date); err != nil {
+			// decimal years may be numbers
+			date = string(rawDate)
+		}
+		t, err := f.parseTime(date)
+		if err != nil {
+			return s, errors.Wrapf(err, "Record %d", i)
+		}
+
+		var v float64
+		var missing bool
+		var str string
+		switch rawValue := record[f.ValueColumn]; {
+		case rawValue == nil || string(rawValue) == "null":
+			missing = true
+		case json.Unmarshal(rawValue, &v) == nil:
+			for _, m := range f.Missing {
+				if string(rawValue) == m {
+					missing = true
+				}
+			}
+		case json.Unmarshal(rawValue, &str) == nil:
+			if v, missing, err = f.parseValue(str); err != nil {
+				return s, errors.Wrapf(err, "Record %d", i)
+			}
+		default:
+			return s, errors.Errorf("Record %d: expected a number. Got %s", i, rawValue)
+		}
+		s.add(t, v, missing)
+	}
+	return s, nil
+}
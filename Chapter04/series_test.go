@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const noaaSample = `# comment
+#            decimal     average   interpolated    trend    #days
+1958   3    1958.208      315.71      315.71      314.62     -1
+1958   4    1958.292      317.45      317.45      315.29     -1
+1958   5    1958.375      317.50      317.50      314.71     -1
+1958   6    1958.458      -99.99      317.10      314.85     -1
+1958   7    1958.542      315.86      315.86      314.98     -1
+`
+
+func TestParseNOAA(t *testing.T) {
+	s, err := parseNOAA(strings.NewReader(noaaSample), "average")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Values) != 5 || s.missing() != 1 || !s.Missing[3] || !math.IsNaN(s.Values[3]) {
+		t.Fatalf("Expected 5 observations, with the fourth missing. Got %v %v", s.Values, s.Missing)
+	}
+	if s.Times[0].Year() != 1958 || s.Times[0].Month() != 3 {
+		t.Errorf("Expected the first observation in March 1958. Got %v", s.Times[0])
+	}
+	if filled := s.filled(); math.Abs(filled[3]-(317.50+315.86)/2) > 1e-9 {
+		t.Errorf("Expected the missing observation interpolated. Got %v", filled)
+	}
+
+	s, err = parseNOAA(strings.NewReader(noaaSample), "interpolated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.missing() != 0 || s.Values[3] != 317.10 {
+		t.Errorf("Expected no missing interpolated observations. Got %v", s.Values)
+	}
+
+	if _, err := parseNOAA(strings.NewReader(noaaSample+"1958 8 1958.625 abc 314.93 315.91 -1\n"), "average"); err == nil || !strings.Contains(err.Error(), "Line 8") {
+		t.Errorf("Expected an error on line 8. Got %v", err)
+	}
+}
+
+func TestReadSeries(t *testing.T) {
+	f := seriesFormat{DateColumn: "day", ValueColumn: "count", Layout: "2006-01-02", Missing: []string{"-1"}}
+
+	csvSeries, err := readCSVSeries(strings.NewReader("count,day\n3,2018-01-01\n,2018-01-02\n-1,2018-01-03\n6,2018-01-04\n"), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonSeries, err := readJSONSeries(strings.NewReader(`[{"day": "2018-01-01", "count": 3}, {"day": "2018-01-02", "count": null},
+		{"day": "2018-01-03", "count": -1}, {"day": "2018-01-04", "count": "6"}]`), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]series{"CSV": csvSeries, "JSON": jsonSeries} {
+		if len(s.Values) != 4 || s.missing() != 2 || s.Values[0] != 3 || s.Values[3] != 6 {
+			t.Errorf("%s: expected 3, two missing and 6. Got %v %v", name, s.Values, s.Missing)
+		}
+		if s.Times[3].Day() != 4 {
+			t.Errorf("%s: expected the last observation on the 4th. Got %v", name, s.Times[3])
+		}
+	}
+
+	if _, err := readCSVSeries(strings.NewReader("date,value\n2018-01-01,1\n"), f); err == nil {
+		t.Errorf("Expected an error for missing columns")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+// diff is the lagged difference of the series, y[t] - y[t-lag]. It is lag values shorter.
+func diff(y []float64, lag int) []float64 {
+	if lag >= len(y) {
+		return nil
+	}
+	retVal := make([]float64, len(y)-lag)
+	for t := range retVal {
+		retVal[t] = y[t+lag] - y[t]
+	}
+	return retVal
+}
+
+// difference differences the series d times, and then seasonally D times with the period.
+func difference(y []float64, d, D, period int) []float64 {
+	for i := 0; i < d; i++ {
+		y = diff(y, 1)
+	}
+	for i := 0; i < D; i++ {
+		y = diff(y, period)
+	}
+	return y
+}
+
+// stationarityTest is the outcome of a test of the stationarity of a series.
+type stationarityTest struct {
+	Name       string
+	Statistic  float64
+	Lags       int
+	Critical   [3]float64 // the critical values at 10%, 5% and 1%
+	Stationary bool       // whether the test finds the series stationary at 5%
+}
+
+func (t stationarityTest) String() string {
+	verdict := "not stationary"
+	if t.Stationary {
+		verdict = "stationary"
+	}
+	return fmt.Sprintf("%s statistic %.4f (%d lags; critical values %.2f, %.2f and %.2f at 10%%, 5%% and 1%%): %s",
+		t.Name, t.Statistic, t.Lags, t.Critical[0], t.Critical[1], t.Critical[2], verdict)
+}
+
+// adf is the augmented Dickey-Fuller test of the null hypothesis that the series has a unit root.
+// The regression has a constant, and a linear trend if trend is set. If lags is negative, the
+// number of lagged differences is Schwert's rule of thumb, 12(n/100)^¼. The critical values are
+// the asymptotic ones of MacKinnon (1996).
+func adf(y []float64, lags int, trend bool) (stationarityTest, error) {
+	if lags < 0 {
+		lags = int(12 * math.Pow(float64(len(y))/100, 0.25))
+	}
+	dy := diff(y, 1)
+	rows := len(dy) - lags
+	cols := 2 + lags
+	if trend {
+		cols++
+	}
+	if rows <= cols {
+		return stationarityTest{}, errors.Errorf("The series of %d observations is too short for the ADF test with %d lags", len(y), lags)
+	}
+
+	// Δy[t] = c + γy[t-1] + δ₁Δy[t-1] + ... + δₖΔy[t-k] (+ βt)
+	x := mat.NewDense(rows, cols, nil)
+	z := mat.NewVecDense(rows, nil)
+	for i := 0; i < rows; i++ {
+		t := i + lags
+		z.SetVec(i, dy[t])
+		x.Set(i, 0, 1)
+		x.Set(i, 1, y[t])
+		for j := 1; j <= lags; j++ {
+			x.Set(i, 1+j, dy[t-j])
+		}
+		if trend {
+			x.Set(i, cols-1, float64(t+1))
+		}
+	}
+	beta, se, err := ols(x, z)
+	if err != nil {
+		return stationarityTest{}, errors.Wrap(err, "ADF regression")
+	}
+
+	retVal := stationarityTest{Name: "ADF", Statistic: beta[1] / se[1], Lags: lags, Critical: [3]float64{-2.57, -2.86, -3.43}}
+	if trend {
+		retVal.Critical = [3]float64{-3.12, -3.41, -3.96}
+	}
+	retVal.Stationary = retVal.Statistic < retVal.Critical[1]
+	return retVal, nil
+}
+
+// ols is the least squares regression of z on the columns of x. It returns the coefficients and
+// their standard errors.
+func ols(x *mat.Dense, z *mat.VecDense) (beta, se []float64, err error) {
+	rows, cols := x.Dims()
+	var b mat.VecDense
+	if err := b.SolveVec(x, z); err != nil {
+		return nil, nil, err
+	}
+	var resid mat.VecDense
+	resid.MulVec(x, &b)
+	resid.SubVec(z, &resid)
+	s2 := mat.Dot(&resid, &resid) / float64(rows-cols)
+
+	var xtx, inv mat.Dense
+	xtx.Mul(x.T(), x)
+	if err := inv.Inverse(&xtx); err != nil {
+		return nil, nil, err
+	}
+	beta = make([]float64, cols)
+	se = make([]float64, cols)
+	for i := range beta {
+		beta[i] = b.AtVec(i)
+		se[i] = math.Sqrt(s2 * inv.At(i, i))
+	}
+	return beta, se, nil
+}
+
+// kpss is the KPSS test of the null hypothesis that the series is stationary around a level, or
+// around a linear trend if trend is set. If lags is negative, the long-run variance is estimated
+// with 4(n/100)^¼ lags. The critical values are those of Kwiatkowski et al. (1992).
+func kpss(y []float64, lags int, trend bool) stationarityTest {
+	n := len(y)
+	if lags < 0 {
+		lags = int(4 * math.Pow(float64(n)/100, 0.25))
+	}
+
+	// the residuals of the regression on a constant (and t)
+	resid := make([]float64, n)
+	if trend {
+		var st, sy, stt, sty float64
+		for t, v := range y {
+			x := float64(t + 1)
+			st += x
+			sy += v
+			stt += x * x
+			sty += x * v
+		}
+		slope := (float64(n)*sty - st*sy) / (float64(n)*stt - st*st)
+		intercept := (sy - slope*st) / float64(n)
+		for t, v := range y {
+			resid[t] = v - intercept - slope*float64(t+1)
+		}
+	} else {
+		var mean float64
+		for _, v := range y {
+			mean += v / float64(n)
+		}
+		for t, v := range y {
+			resid[t] = v - mean
+		}
+	}
+
+	// the long-run variance, with the Bartlett window
+	var s2 float64
+	for _, e := range resid {
+		s2 += e * e
+	}
+	for l := 1; l <= lags; l++ {
+		var cov float64
+		for t := l; t < n; t++ {
+			cov += resid[t] * resid[t-l]
+		}
+		s2 += 2 * (1 - float64(l)/float64(lags+1)) * cov
+	}
+	s2 /= float64(n)
+
+	var partial, eta float64
+	for _, e := range resid {
+		partial += e
+		eta += partial * partial
+	}
+	eta /= float64(n) * float64(n) * s2
+
+	retVal := stationarityTest{Name: "KPSS", Statistic: eta, Lags: lags, Critical: [3]float64{0.347, 0.463, 0.739}}
+	if trend {
+		retVal.Critical = [3]float64{0.119, 0.146, 0.216}
+	}
+	retVal.Stationary = retVal.Statistic < retVal.Critical[1]
+	return retVal
+}
+
+// seasonalStrength is the strength of the seasonality of the series, between 0 and 1, as in
+// Wang, Smith and Hyndman (2006): 1 - Var(remainder) / Var(seasonal + remainder), where the series
+// is decomposed with a centred moving average.
+func seasonalStrength(y []float64, period int) float64 {
+	ma := centredMovingAverage(y, period)
+	sums, counts := make([]float64, period), make([]float64, period)
+	for t, avg := range ma {
+		if !math.IsNaN(avg) {
+			sums[t%period] += y[t] - avg
+			counts[t%period]++
+		}
+	}
+	var detrended, remainder []float64
+	for t, avg := range ma {
+		if math.IsNaN(avg) {
+			continue
+		}
+		detrended = append(detrended, y[t]-avg)
+		remainder = append(remainder, y[t]-avg-sums[t%period]/counts[t%period])
+	}
+	if len(detrended) < 2 {
+		return 0
+	}
+	return math.Max(0, 1-variance(remainder)/variance(detrended))
+}
+
+func variance(a []float64) (retVal float64) {
+	var mean float64
+	for _, v := range a {
+		mean += v / float64(len(a))
+	}
+	for _, v := range a {
+		retVal += (v - mean) * (v - mean)
+	}
+	return retVal / float64(len(a)-1)
+}
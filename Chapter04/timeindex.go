@@ -0,0 +1,238 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// frequency is the spacing of the observations of a series.
+type frequency int
+
+const (
+	irregular frequency = iota
+	daily
+	weekly
+	monthly
+)
+
+func parseFrequency(s string) (frequency, error) {
+	switch s {
+	case "daily":
+		return daily, nil
+	case "weekly":
+		return weekly, nil
+	case "monthly":
+		return monthly, nil
+	case "irregular":
+		return irregular, nil
+	}
+	return irregular, errors.Errorf("Unknown frequency %q. Expected daily, weekly, monthly or irregular", s)
+}
+
+func (f frequency) String() string {
+	switch f {
+	case daily:
+		return "daily"
+	case weekly:
+		return "weekly"
+	case monthly:
+		return "monthly"
+	}
+	return "irregular"
+}
+
+// period is the number of observations in a seasonal cycle: a week of days, a year of weeks or a
+// year of months. Irregular series have no seasonal cycle.
+func (f frequency) period() int {
+	switch f {
+	case daily:
+		return 7
+	case weekly:
+		return 52
+	case monthly:
+		return 12
+	}
+	return 0
+}
+
+// add returns the time n steps after t. Monthly steps from a day that the later month lacks, like
+// the 31st, end on its last day rather than spilling into the month after.
+func (f frequency) add(t time.Time, n int) time.Time {
+	switch f {
+	case daily:
+		return t.AddDate(0, 0, n)
+	case weekly:
+		return t.AddDate(0, 0, 7*n)
+	case monthly:
+		y, m, d := t.Date()
+		if last := time.Date(y, m+time.Month(n)+1, 0, 0, 0, 0, 0, t.Location()).Day(); d > last {
+			d = last
+		}
+		return time.Date(y, m+time.Month(n), d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	}
+	panic("add: irregular series have no steps")
+}
+
+// truncate returns the start of the step that t is in. Weeks start on Monday.
+func (f frequency) truncate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch f {
+	case daily:
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	case weekly:
+		offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, t.Location())
+	case monthly:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	}
+	panic("truncate: irregular series have no steps")
+}
+
+// gapDays are the ranges of the gaps between observations, in days, of every frequency. They are
+// loose enough for daylight saving time, and for monthly observations that are not on the same
+// day of every month, like NOAA's decimal dates.
+var gapDays = []struct {
+	freq     frequency
+	min, max float64
+}{
+	{daily, 0.9, 1.1},
+	{weekly, 6.9, 7.1},
+	{monthly, 27, 32},
+}
+
+// inferFrequency returns the frequency whose gaps all the gaps between the times fit in, or
+// irregular if there is none.
+func inferFrequency(times []time.Time) frequency {
+	if len(times) < 2 {
+		return irregular
+	}
+outer:
+	for _, g := range gapDays {
+		for i := 1; i < len(times); i++ {
+			days := times[i].Sub(times[i-1]).Hours() / 24
+			if days < g.min || days > g.max {
+				continue outer
+			}
+		}
+		return g.freq
+	}
+	return irregular
+}
+
+// timeIndex is the times of the observations of a series, and their frequency.
+type timeIndex struct {
+	Times []time.Time
+	Freq  frequency
+}
+
+// newTimeIndex infers the frequency of the times.
+func newTimeIndex(times []time.Time) timeIndex {
+	return timeIndex{Times: times, Freq: inferFrequency(times)}
+}
+
+// extend returns the times followed by the times of the next n steps. The steps of irregular
+// series are the median gap between observations.
+func (ix timeIndex) extend(n int) []time.Time {
+	retVal := make([]time.Time, len(ix.Times), len(ix.Times)+n)
+	copy(retVal, ix.Times)
+	if len(ix.Times) == 0 {
+		return retVal
+	}
+	last := ix.Times[len(ix.Times)-1]
+	if ix.Freq != irregular {
+		for i := 1; i <= n; i++ {
+			retVal = append(retVal, ix.Freq.add(last, i))
+		}
+		return retVal
+	}
+
+	var gap time.Duration
+	if len(ix.Times) > 1 {
+		gaps := make([]float64, len(ix.Times)-1)
+		for i := range gaps {
+			gaps[i] = float64(ix.Times[i+1].Sub(ix.Times[i]))
+		}
+		sort.Float64s(gaps)
+		gap = time.Duration(gaps[len(gaps)/2])
+	}
+	for i := 1; i <= n; i++ {
+		retVal = append(retVal, last.Add(time.Duration(i)*gap))
+	}
+	return retVal
+}
+
+// parseTimeLayout parses a time in the layout, as in time.Parse. The layout is RFC 3339 if empty,
+// and decimal years, like 2018.375, if "decimal". Times without a zone are in loc.
+func parseTimeLayout(s, layout string, loc *time.Location) (time.Time, error) {
+	switch layout {
+	case "":
+		return time.Parse(time.RFC3339, s)
+	case "decimal":
+		return parseDecimalDate(s, loc)
+	}
+	return time.ParseInLocation(layout, s, loc)
+}
+
+// aggregation is how the observations that fall in the same step are combined when resampling.
+type aggregation string
+
+const (
+	aggSum  aggregation = "sum"
+	aggMean aggregation = "mean"
+	aggLast aggregation = "last"
+)
+
+// resample returns the series at the frequency, with the observations in every step aggregated.
+// The times are the starts of the steps. Steps without observations, which there are when
+// resampling to a higher frequency, are missing.
+func (s series) resample(f frequency, agg aggregation) (series, error) {
+	switch agg {
+	case aggSum, aggMean, aggLast:
+	default:
+		return series{}, errors.Errorf("Unknown aggregation %q. Expected sum, mean or last", agg)
+	}
+	if f == irregular {
+		return series{}, errors.New("Unable to resample to an irregular frequency")
+	}
+
+	order := make([]int, len(s.Times))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return s.Times[order[i]].Before(s.Times[order[j]]) })
+
+	var retVal series
+	if len(order) == 0 {
+		return retVal, nil
+	}
+	start := f.truncate(s.Times[order[0]])
+	for k := 0; k < len(order); {
+		end := f.add(start, 1)
+		var sum, last float64
+		var n int
+		for ; k < len(order) && s.Times[order[k]].Before(end); k++ {
+			if i := order[k]; !s.Missing[i] {
+				sum += s.Values[i]
+				last = s.Values[i]
+				n++
+			}
+		}
+
+		v := math.NaN()
+		switch {
+		case n == 0:
+		case agg == aggSum:
+			v = sum
+		case agg == aggMean:
+			v = sum / float64(n)
+		case agg == aggLast:
+			v = last
+		}
+		retVal.add(start, v, n == 0)
+		start = end
+	}
+	return retVal, nil
+}
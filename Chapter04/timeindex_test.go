@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeIndex(t *testing.T) {
+	start := time.Date(2018, time.January, 31, 0, 0, 0, 0, time.UTC)
+	days := make([]time.Time, 10)
+	for i := range days {
+		days[i] = start.AddDate(0, 0, i)
+	}
+	noaa, err := parseNOAA(strings.NewReader(noaaSample), "average")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		times []time.Time
+		freq  frequency
+	}{
+		{days, daily},
+		{[]time.Time{start, start.AddDate(0, 0, 7), start.AddDate(0, 0, 14)}, weekly},
+		{noaa.Times, monthly},
+		{[]time.Time{start, start.AddDate(0, 0, 1), start.AddDate(0, 0, 3)}, irregular},
+	} {
+		if got := inferFrequency(tc.times); got != tc.freq {
+			t.Errorf("Expected %v for %v. Got %v", tc.freq, tc.times, got)
+		}
+	}
+
+	ext := timeIndex{Times: []time.Time{start}, Freq: monthly}.extend(2)
+	if ext[1].Day() != 28 || ext[2].Day() != 31 || ext[2].Month() != time.March {
+		t.Errorf("Expected the ends of February and March. Got %v", ext)
+	}
+	ext = timeIndex{Times: []time.Time{start, start.Add(time.Hour), start.Add(3 * time.Hour)}}.extend(1)
+	if ext[3] != start.Add(5*time.Hour) {
+		t.Errorf("Expected an irregular series to step by the median gap. Got %v", ext)
+	}
+
+	if d, err := parseTimeLayout("2018", "decimal", time.UTC); err != nil || !d.Equal(time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the start of 2018. Got %v, %v", d, err)
+	}
+}
+
+func TestResample(t *testing.T) {
+	// Wednesday 31 January 2018 to Sunday 18 February, with the second week missing
+	var s series
+	start := time.Date(2018, time.January, 31, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 19; i++ {
+		d := start.AddDate(0, 0, i)
+		s.add(d, float64(i+1), d.Day() >= 5 && d.Day() <= 11)
+	}
+
+	for agg, want := range map[aggregation][]float64{
+		aggSum:  {1 + 2 + 3 + 4 + 5, math.NaN(), 13 + 14 + 15 + 16 + 17 + 18 + 19},
+		aggMean: {3, math.NaN(), 16},
+		aggLast: {5, math.NaN(), 19},
+	} {
+		w, err := s.resample(weekly, agg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(w.Values) != 3 || w.Times[0] != time.Date(2018, time.January, 29, 0, 0, 0, 0, time.UTC) {
+			t.Fatalf("%v: expected three weeks from Monday 29 January. Got %v", agg, w.Times)
+		}
+		for i := range want {
+			if w.Missing[i] != math.IsNaN(want[i]) || !w.Missing[i] && w.Values[i] != want[i] {
+				t.Errorf("%v: expected %v. Got %v", agg, want, w.Values)
+				break
+			}
+		}
+	}
+
+	if _, err := s.resample(weekly, "median"); err == nil {
+		t.Errorf("Expected an error for an unknown aggregation")
+	}
+}
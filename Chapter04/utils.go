@@ -8,24 +8,16 @@ import (
 	"github.com/pkg/errors"
 )
 
-func parseDates(a []string) []time.Time {
-	loc, err := time.LoadLocation("Pacific/Honolulu")
-	dieIfErr(err)
-	retVal := make([]time.Time, len(a))
-	for i := range a {
-		t, err := parseDecimalDate(a[i], loc)
-		dieIfErr(err)
-		retVal[i] = t
-	}
-	return retVal
-}
-
 // parseDecimalDate takes a string in format of a decimal date
 //	"2018.05" and converts it into a date.
+// A year without a decimal, like "2018", is the start of the year.
 //
 func parseDecimalDate(a string, loc *time.Location) (time.Time, error) {
-	split := strings.Split(a, ".")
-	if len(split) != 2 {
+	split := strings.Split(strings.TrimSpace(a), ".")
+	switch {
+	case len(split) == 1, len(split) == 2 && split[1] == "":
+		split = []string{split[0], "0"}
+	case len(split) != 2:
 		return time.Time{}, errors.Errorf("Unable to split %q into a year followed by a decimal", a)
 	}
 	year, err := strconv.Atoi(split[0])